@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+)
+
+// abortResult is the summary printed by -abort and -abort-all with -output json
+type abortResult struct {
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key,omitempty"`
+	UploadID string `json:"uploadId,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+	Aborted  int    `json:"aborted"`
+}
+
+// runAbort aborts the -abort upload of -key, or with -abort-all every unfinished
+// upload under -prefix, and reports what was aborted
+func runAbort(ctx context.Context, w io.Writer, u *uploader.Uploader, opts *options) error {
+	result := abortResult{Bucket: opts.bucket}
+	if opts.abortAll {
+		result.Prefix = opts.prefix
+		aborted, err := u.AbortStale(ctx, opts.prefix, 0)
+		if err != nil {
+			// The uploads aborted before the error are gone all the same
+			if aborted > 0 {
+				slog.Warn("aborted some multipart uploads before failing", "count", aborted, "prefix", opts.prefix)
+			}
+			return err
+		}
+		result.Aborted = aborted
+		slog.Info("aborted unfinished multipart uploads", "count", aborted, "bucket", opts.bucket, "prefix", opts.prefix)
+	} else {
+		result.Key, result.UploadID = opts.key, opts.abort
+		if err := u.Abort(ctx, opts.key, opts.abort); err != nil {
+			return err
+		}
+		result.Aborted = 1
+		slog.Info("aborted multipart upload", "bucket", opts.bucket, "key", opts.key, "upload_id", opts.abort)
+	}
+	if opts.output == "json" {
+		return writeJSON(w, result)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/term"
+)
+
+// coldStorage reports whether objects of class can't be read back right away,
+// but only after a restore that takes minutes to hours
+func coldStorage(class types.StorageClass) bool {
+	return class == types.StorageClassGlacier || class == types.StorageClassDeepArchive
+}
+
+// confirmCold has the user confirm an upload to a cold storage class, unless
+// -confirm-cold is set. Without a terminal to ask on, the flag is required.
+func confirmCold(opts *options) error {
+	if !coldStorage(types.StorageClass(opts.storageClass)) || opts.confirmCold {
+		return nil
+	}
+	if opts.file == stdinFile || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("-storage-class %s objects can't be read back without a restore, set -confirm-cold to upload anyway", opts.storageClass)
+	}
+	return askCold(os.Stderr, os.Stdin, opts.storageClass)
+}
+
+// askCold asks on w whether to upload to class and reads the answer from r
+func askCold(w io.Writer, r io.Reader, class string) error {
+	fmt.Fprintf(w, "Objects in %s can't be read back without a restore that takes hours. Upload anyway? [y/N] ", class)
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("cannot read answer: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errors.New("upload to cold storage not confirmed")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfig sets the flags of fs from the YAML file at path, keyed by the flag names
+// such as bucket, part-size or sns-topic. Flags given on the command line aren't
+// overridden, metadata and tag take a mapping of key: value pairs.
+func loadConfig(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("cannot parse config file %s: %w", path, err)
+	}
+
+	onCommandLine := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		onCommandLine[f.Name] = true
+	})
+
+	var unknown []string
+	for name := range values {
+		if fs.Lookup(name) == nil || name == "config" {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown keys in config file %s: %s", path, strings.Join(unknown, ", "))
+	}
+
+	for name, value := range values {
+		if onCommandLine[name] {
+			continue
+		}
+		for _, s := range configValues(value) {
+			if err := fs.Set(name, s); err != nil {
+				return fmt.Errorf("invalid %s in config file %s: %w", name, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues turns a config value into the strings passed to the flag, one for
+// each key: value pair of a mapping
+func configValues(value any) []string {
+	switch v := value.(type) {
+	case map[string]any:
+		pairs := make([]string, 0, len(v))
+		for k, val := range v {
+			pairs = append(pairs, k+"="+fmt.Sprint(val))
+		}
+		sort.Strings(pairs)
+		return pairs
+	case nil:
+		return []string{""}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+)
+
+// writeConfig writes a config file with content and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigConcurrency(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		args    []string
+		want    int
+		wantErr string
+	}{
+		{name: "default", config: "bucket: b\nfile: f\n", want: uploader.DefaultConcurrency},
+		{name: "from the config", config: "bucket: b\nfile: f\nconcurrency: 16\n", want: 16},
+		{name: "command line wins", config: "bucket: b\nfile: f\nconcurrency: 16\n", args: []string{"-concurrency", "2"}, want: 2},
+		{name: "zero", config: "bucket: b\nfile: f\nconcurrency: 0\n", wantErr: "invalid -concurrency 0"},
+		{name: "not a number", config: "bucket: b\nfile: f\nconcurrency: many\n", wantErr: "invalid concurrency in config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-config", writeConfig(t, tt.config)}, tt.args...)
+			opts, err := parseFlags(args, io.Discard)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseFlags error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.concurrency != tt.want {
+				t.Errorf("concurrency = %d, want %d", opts.concurrency, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// User metadata key holding the SHA256 of the uploaded content for -dedupe
+const sha256MetadataKey = "sha256"
+
+// fileSHA256 returns the hex SHA256 of the size bytes of r
+func fileSHA256(r io.ReaderAt, size int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+		return "", fmt.Errorf("cannot hash file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// headObject returns the object at key in the bucket of u, or nil when it doesn't
+// exist or S3 denies looking it up
+func headObject(ctx context.Context, u *uploader.Uploader, key string) (*s3.HeadObjectOutput, error) {
+	head, err := u.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:              aws.String(u.Bucket),
+		Key:                 aws.String(key),
+		RequestPayer:        u.RequestPayer,
+		ExpectedBucketOwner: nonEmpty(u.ExpectedBucketOwner),
+	})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	// Without s3:ListBucket S3 answers 403 rather than 404 for a missing key, so the
+	// object is taken as missing. An existing one is still refused by the
+	// If-None-Match: * of NoOverwrite, and -dedupe uploads it again.
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusForbidden {
+		slog.Warn("cannot check existing object, access denied without s3:ListBucket", "key", key, "error", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot check existing object %s: %w", key, err)
+	}
+	return head, nil
+}
+
+// sameContent reports whether the existing object head was uploaded by -dedupe with
+// the SHA256 sum
+func sameContent(head *s3.HeadObjectOutput, sum string) bool {
+	return head != nil && head.Metadata[sha256MetadataKey] == sum
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// headClient answers HeadObject with err, the other requests aren't expected
+type headClient struct {
+	uploader.S3API
+	err error
+}
+
+func (c headClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return nil, c.err
+}
+
+// statusError returns an error like those of the SDK for an S3 response with the status
+func statusError(status int) error {
+	return &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+		Err:      &smithy.GenericAPIError{Code: http.StatusText(status)},
+	}
+}
+
+func TestHeadObjectStatus(t *testing.T) {
+	tests := []struct {
+		status  int
+		wantErr bool
+	}{
+		// S3 answers 403 for a missing key without s3:ListBucket
+		{http.StatusForbidden, false},
+		{http.StatusInternalServerError, true},
+		{http.StatusMovedPermanently, true},
+	}
+	for _, tt := range tests {
+		u := &uploader.Uploader{Client: headClient{err: statusError(tt.status)}, Bucket: "bucket", NoOverwrite: true}
+		head, err := headObject(context.Background(), u, "key")
+		if (err != nil) != tt.wantErr || head != nil {
+			t.Errorf("headObject with status %d = %v, %v, want error %v", tt.status, head, err, tt.wantErr)
+		}
+	}
+}
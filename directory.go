@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+)
+
+// fileResult holds the outcome of uploading one file of a directory
+type fileResult struct {
+	path    string
+	key     string
+	summary uploadSummary
+	err     error
+}
+
+// runFiles uploads the files of a directory or a manifest, reports the result of
+// each file and notifies once about all of them
+func runFiles(ctx context.Context, u *uploader.Uploader, notifier Notifier, opts *options, files []fileEntry) error {
+	results := uploadFiles(ctx, u, opts, files)
+
+	// Report per-file success/failure at the end
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+			slog.Error("file upload failed", "path", result.path, "key", result.key, "error", result.err)
+		} else if result.summary.Skipped {
+			slog.Info("file skipped (already uploaded)", "path", result.path, "key", result.key)
+		} else {
+			attrs := []any{"path", result.path, "key", result.key}
+			if result.summary.CRC32C != "" {
+				attrs = append(attrs, "crc32c", result.summary.CRC32C)
+			}
+			if result.summary.SHA256 != "" {
+				attrs = append(attrs, "sha256", result.summary.SHA256)
+			}
+			slog.Info("file uploaded", attrs...)
+		}
+	}
+	if opts.output == "json" {
+		summaries := make([]uploadSummary, 0, len(results))
+		for _, result := range results {
+			summaries = append(summaries, result.summary)
+		}
+		if err := writeJSON(os.Stdout, summaries); err != nil {
+			slog.Error("cannot print upload summary", "error", err)
+		}
+	}
+	if canceled(ctx) {
+		return ctx.Err()
+	}
+	if ctx.Err() != nil {
+		err := fmt.Errorf("upload did not finish within -timeout %s, %d of %d files uploaded: %w", opts.timeout, len(results)-failed, len(files), ctx.Err())
+		notify(ctx, notifier, "Upload Failed", fmt.Sprintf("Error: %v", err))
+		return err
+	}
+	if failed > 0 {
+		err := fmt.Errorf("%d of %d files failed to upload", failed, len(files))
+		if notStarted := len(files) - len(results); notStarted > 0 {
+			err = fmt.Errorf("%w, %d not started after the first failure", err, notStarted)
+		}
+		notify(ctx, notifier, "Upload Failed", fmt.Sprintf("Error: %v", err))
+		return err
+	}
+	notify(ctx, notifier, "Upload Successful", fmt.Sprintf("Uploaded %d files successfully.", len(results)))
+	return nil
+}
+
+// uploadFiles uploads each file to its key. Up to -parallel-files files are
+// uploaded at the same time, sharing a single pool of part uploads. A failed file
+// doesn't stop the others unless -fail-fast is set, its error is recorded in the
+// results, which are in the order of files and stop at the last file started.
+func uploadFiles(ctx context.Context, u *uploader.Uploader, opts *options, files []fileEntry) []fileResult {
+	shared := *u
+	// The part size of each file is only known once it is uploaded, so the pool is
+	// sized for the configured or default one
+	shared.Pool = uploader.NewPartPool(u.ConcurrencyFor(max(u.PartSize, uploader.DefaultPartSize)))
+	results := make([]fileResult, len(files))
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+	sem := make(chan struct{}, opts.parallelFiles)
+	// Files left once the upload is cancelled, timed out or failed fast aren't started
+	started := 0
+	for i, file := range files {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil || (opts.failFast && failed.Load()) {
+			break
+		}
+		started++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			slog.Info("uploading file", "path", file.path, "bucket", opts.bucket, "key", file.key)
+			start := time.Now()
+			resp, t, err := uploadFile(ctx, &shared, opts, file.path, file.key)
+			err = accelerateError(opts, err)
+			if err != nil {
+				failed.Store(true)
+			}
+			summary := newSummary(opts.bucket, file.key, resp, t, start, err)
+			results[i] = fileResult{path: file.path, key: file.key, summary: summary, err: err}
+		}()
+	}
+	wg.Wait()
+	return results[:started]
+}
+
+// fileEntry is a local file and the key it is uploaded to
+type fileEntry struct {
+	path string
+	key  string
+}
+
+// directoryFiles walks the -file directory and returns its regular files, keyed
+// by the -prefix key prefix followed by their path relative to the directory
+func directoryFiles(ctx context.Context, opts *options) ([]fileEntry, error) {
+	var files []fileEntry
+	// Every key is expanded with the same date, even when the upload runs past midnight
+	now := time.Now()
+	// walk adds the files under dir, keyed by their path relative to the upload
+	// directory. walking holds the real paths of the directories being walked,
+	// which a followed symlink mustn't lead back into.
+	var walk func(dir, relDir string, walking []string) error
+	walk = func(dir, relDir string, walking []string) error {
+		return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.Join(relDir, rel)
+			if d.Type()&fs.ModeSymlink != 0 && opts.followSymlinks {
+				target, err := followSymlink(p, walking)
+				if err != nil || target == nil {
+					return err
+				}
+				if target.IsDir() {
+					real, _ := filepath.EvalSymlinks(p)
+					return walk(p+string(filepath.Separator), rel, append(walking, real))
+				}
+			} else if !d.Type().IsRegular() {
+				// Only regular files are uploaded, directories only make up the keys
+				return nil
+			}
+			key, err := fileKey(opts, rel, now)
+			if err != nil {
+				return err
+			}
+			files = append(files, fileEntry{path: p, key: key})
+			return nil
+		})
+	}
+	var walking []string
+	if real, err := filepath.EvalSymlinks(opts.file); err == nil {
+		walking = append(walking, real)
+	}
+	err := walk(opts.file, "", walking)
+	if err != nil && err != ctx.Err() {
+		return nil, fmt.Errorf("cannot walk directory: %s: %w", opts.file, err)
+	}
+	return files, nil
+}
+
+// fileKey returns the key of the file at the relative path rel: -key-template
+// expanded for it, or else rel under -prefix
+func fileKey(opts *options, rel string, now time.Time) (string, error) {
+	if opts.keyTemplate != nil {
+		return expandKey(opts.keyTemplate, filepath.ToSlash(rel), now)
+	}
+	key := path.Join(opts.prefix, filepath.ToSlash(rel))
+	if opts.gzip {
+		key += gzipSuffix
+	}
+	return key, nil
+}
+
+// followSymlink returns the file info of the target of the symlink at p, or nil
+// when the target is neither a regular file nor a directory, is broken, or is a
+// directory that would loop back into one of walking
+func followSymlink(p string, walking []string) (fs.FileInfo, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		slog.Warn("skipped broken symlink", "path", p, "error", err)
+		return nil, nil
+	}
+	if !info.IsDir() {
+		if !info.Mode().IsRegular() {
+			return nil, nil
+		}
+		return info, nil
+	}
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range append(walking, parent) {
+		if isWithin(dir, real) {
+			slog.Warn("skipped symlink cycle", "path", p, "target", real)
+			return nil, nil
+		}
+	}
+	return info, nil
+}
+
+// isWithin reports whether the path p is dir or inside it
+func isWithin(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+)
+
+// countingNotifier records the notifications sent
+type countingNotifier struct {
+	mu       sync.Mutex
+	subjects []string
+}
+
+func (n *countingNotifier) Notify(ctx context.Context, subject, message string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.subjects = append(n.subjects, subject)
+	return nil
+}
+
+func TestRunFilesNotifiesFailureOnce(t *testing.T) {
+	dir := t.TempDir()
+	// Files that can't be opened fail before anything is sent to S3
+	files := []fileEntry{
+		{path: filepath.Join(dir, "missing-1"), key: "missing-1"},
+		{path: filepath.Join(dir, "missing-2"), key: "missing-2"},
+		{path: filepath.Join(dir, "missing-3"), key: "missing-3"},
+	}
+	opts := &options{bucket: "bucket", parallelFiles: 2, overwrite: true}
+	notifier := &countingNotifier{}
+	err := runFiles(context.Background(), &uploader.Uploader{Bucket: "bucket"}, notifier, opts, files)
+	if err == nil || !strings.Contains(err.Error(), "3 of 3 files failed to upload") {
+		t.Fatalf("runFiles error = %v, want the 3 failed files", err)
+	}
+	if len(notifier.subjects) != 1 || notifier.subjects[0] != "Upload Failed" {
+		t.Errorf("notifications %q, want a single Upload Failed", notifier.subjects)
+	}
+}
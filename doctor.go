@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Key of the object written and deleted by -doctor, under -prefix
+const doctorKey = ".go-s3-uploader-doctor"
+
+// doctorCheck is the outcome of one -doctor check, with a hint to fix it when it failed
+type doctorCheck struct {
+	name   string
+	detail string
+	err    error
+	hint   string
+}
+
+// runDoctor checks that the credentials, the bucket, its region and the
+// notification work before a real upload, and prints the result of each check
+func runDoctor(ctx context.Context, w io.Writer, cfg aws.Config, opts *options) error {
+	client := newS3Client(cfg, opts)
+	var checks []doctorCheck
+
+	// The credentials resolve and are accepted by AWS
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		checks = append(checks, doctorCheck{name: "credentials", err: err,
+			hint: "set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or pick a configured profile with -profile"})
+	} else {
+		checks = append(checks, doctorCheck{name: "credentials", detail: aws.ToString(identity.Arn)})
+	}
+
+	// The bucket exists, can be reached and is in the region of the requests
+	head, err := client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket:              aws.String(opts.bucket),
+		ExpectedBucketOwner: nonEmpty(opts.expectedBucketOwner),
+	})
+	if err != nil {
+		checks = append(checks, doctorCheck{name: "bucket", err: err, hint: bucketHint(err)})
+	} else {
+		checks = append(checks, doctorCheck{name: "bucket", detail: opts.bucket})
+		region := aws.ToString(head.BucketRegion)
+		if region != "" && region != cfg.Region {
+			checks = append(checks, doctorCheck{name: "region", err: fmt.Errorf("bucket is in %s but the requests go to %q", region, cfg.Region),
+				hint: "set -region " + region})
+		} else {
+			checks = append(checks, doctorCheck{name: "region", detail: cfg.Region})
+		}
+	}
+
+	// A tiny object can be written and removed again
+	key := path.Join(opts.prefix, doctorKey)
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:              aws.String(opts.bucket),
+		Key:                 aws.String(key),
+		Body:                strings.NewReader("ok"),
+		RequestPayer:        requestPayer(opts),
+		ExpectedBucketOwner: nonEmpty(opts.expectedBucketOwner),
+	})
+	if err != nil {
+		checks = append(checks, doctorCheck{name: "write", err: err, hint: "allow s3:PutObject on the objects of the bucket"})
+	} else {
+		_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket:              aws.String(opts.bucket),
+			Key:                 aws.String(key),
+			RequestPayer:        requestPayer(opts),
+			ExpectedBucketOwner: nonEmpty(opts.expectedBucketOwner),
+		})
+		if err != nil {
+			checks = append(checks, doctorCheck{name: "write", err: fmt.Errorf("cannot delete test object %s: %w", key, err),
+				hint: "allow s3:DeleteObject, or delete the test object by hand"})
+		} else {
+			checks = append(checks, doctorCheck{name: "write", detail: "put and deleted " + key})
+		}
+	}
+
+	// The notification of the result can be sent
+	if opts.notify == "none" || (opts.notify == "sns" && opts.snsTopic == "") {
+		checks = append(checks, doctorCheck{name: "notification", detail: "none configured"})
+	} else if err := newNotifier(cfg, opts).Notify(ctx, "Upload Test", "Test notification sent by go-s3-uploader -doctor."); err != nil {
+		checks = append(checks, doctorCheck{name: "notification", err: err,
+			hint: "allow sns:Publish on the -sns-topic, or check the -webhook-url"})
+	} else {
+		checks = append(checks, doctorCheck{name: "notification", detail: "test notification sent"})
+	}
+
+	failed := 0
+	for _, c := range checks {
+		if c.err == nil {
+			fmt.Fprintf(w, "PASS %s: %s\n", c.name, c.detail)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "FAIL %s: %v\n     hint: %s\n", c.name, c.err, c.hint)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// bucketHint explains why the bucket can't be reached from the status S3 answered with
+func bucketHint(err error) string {
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case http.StatusNotFound:
+			return "the bucket doesn't exist, check -bucket"
+		case http.StatusForbidden:
+			return "allow s3:ListBucket on the bucket, or check -expected-bucket-owner"
+		case http.StatusMovedPermanently:
+			return "the bucket is in another region, set -region"
+		}
+	}
+	return "check the network access to S3 and -endpoint-url"
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+)
+
+// printPlan prints how the upload would be done for -dry-run, without making any
+// AWS call. With multiFile, files are the files of a directory or a manifest.
+func printPlan(w io.Writer, u *uploader.Uploader, opts *options, multiFile bool, files []fileEntry) error {
+	fmt.Fprintf(w, "Bucket: %s\n", opts.bucket)
+	switch {
+	case opts.file == stdinFile:
+		fmt.Fprintf(w, "Key: %s\n", opts.key)
+		plan := u.Plan(-1)
+		fmt.Fprintf(w, "Size: unknown (stdin), parts of %d bytes up to %d concurrently\n", plan.PartSize, plan.Concurrency)
+		return nil
+	case multiFile:
+		for _, file := range files {
+			info, err := os.Stat(file.path)
+			if err != nil {
+				return fmt.Errorf("cannot stat file: %s: %w", file.path, err)
+			}
+			fmt.Fprintf(w, "\n")
+			printFilePlan(w, file.key, u.Plan(info.Size()))
+		}
+		return nil
+	}
+
+	info, err := os.Stat(opts.file)
+	if err != nil {
+		return fmt.Errorf("cannot stat file: %s: %w", opts.file, err)
+	}
+	printFilePlan(w, opts.key, u.Plan(info.Size()))
+	return nil
+}
+
+// printFilePlan prints the plan of a single object
+func printFilePlan(w io.Writer, key string, plan uploader.Plan) {
+	fmt.Fprintf(w, "Key: %s\n", key)
+	fmt.Fprintf(w, "Size: %d bytes\n", plan.Size)
+	if !plan.Multipart {
+		fmt.Fprintf(w, "Upload: single PutObject\n")
+		return
+	}
+	fmt.Fprintf(w, "Upload: multipart\n")
+	fmt.Fprintf(w, "Part size: %d bytes\n", plan.PartSize)
+	fmt.Fprintf(w, "Parts: %d\n", plan.Parts)
+	fmt.Fprintf(w, "Concurrency: %d\n", plan.Concurrency)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+)
+
+func TestPrintPlanOfStdin(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxBufferMemory int64
+		want            string
+	}{
+		{"default", 0, "parts of 50000000 bytes up to 8 concurrently"},
+		// The stream upload lowers the concurrency to fit its buffers
+		{"max buffer memory", 120_000_000, "parts of 50000000 bytes up to 2 concurrently"},
+	}
+	for _, tt := range tests {
+		u := &uploader.Uploader{Concurrency: 8, MaxBufferMemory: tt.maxBufferMemory}
+		var out bytes.Buffer
+		if err := printPlan(&out, u, &options{bucket: "bucket", file: stdinFile, key: "key"}, false, nil); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), tt.want) {
+			t.Errorf("%s: plan is %q, want it to contain %q", tt.name, out.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keyValueFlag is a repeatable flag of key=value pairs
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set parses one key=value pair, rejecting a missing "=", an empty key and a repeated key
+func (f keyValueFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("%q is not in key=value form", s)
+	}
+	if k == "" {
+		return fmt.Errorf("%q has an empty key", s)
+	}
+	if _, dup := f[k]; dup {
+		return fmt.Errorf("key %q is set more than once", k)
+	}
+	f[k] = v
+	return nil
+}
+
+// byteSizeFlag is a flag of a number of bytes, given as a plain number or with a
+// unit: KB, MB, GB and TB are powers of 1000, KiB, MiB, GiB and TiB powers of 1024
+type byteSizeFlag struct {
+	n *int64
+}
+
+func (f byteSizeFlag) String() string {
+	if f.n == nil {
+		return "0"
+	}
+	return strconv.FormatInt(*f.n, 10)
+}
+
+func (f byteSizeFlag) Set(s string) error {
+	n, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*f.n = n
+	return nil
+}
+
+// Multipliers of the units of byteSizeFlag, upper-cased
+var byteUnits = map[string]int64{
+	"B":   1,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+	"TIB": 1 << 40,
+}
+
+// parseByteSize parses a number of bytes such as 50000000, 50MB, 64MiB or 1.5GB.
+// A unit without B, such as 50M, is rejected as it could mean either power.
+func parseByteSize(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i <= 0 {
+		return 0, fmt.Errorf("%q is not a size such as 50000000, 50MB or 64MiB", s)
+	}
+	number, unit := s[:i], strings.ToUpper(strings.TrimSpace(s[i:]))
+	mult, ok := byteUnits[unit]
+	if !ok {
+		if _, ok := byteUnits[unit+"B"]; ok {
+			return 0, fmt.Errorf("%q has an ambiguous unit, use %sB for powers of 1000 or %siB for powers of 1024", s, unit, unit)
+		}
+		return 0, fmt.Errorf("%q has an unknown unit %q, use B, KB, MB, GB, TB, KiB, MiB, GiB or TiB", s, s[i:])
+	}
+	size, ok := new(big.Rat).SetString(number)
+	if !ok {
+		return 0, fmt.Errorf("%q is not a size such as 50000000, 50MB or 64MiB", s)
+	}
+	size.Mul(size, big.NewRat(mult, 1))
+	if !size.IsInt() {
+		return 0, fmt.Errorf("%q is not a whole number of bytes", s)
+	}
+	if !size.Num().IsInt64() {
+		return 0, fmt.Errorf("%q is too large", s)
+	}
+	return size.Num().Int64(), nil
+}
+
+// contentTypeMapFlag maps file extensions, lower-cased with their leading dot, to
+// the MIME type of their objects. It takes a comma-separated list of .ext=type
+// pairs and can be repeated.
+type contentTypeMapFlag map[string]string
+
+func (f contentTypeMapFlag) String() string {
+	return keyValueFlag(f).String()
+}
+
+// Set parses .ext=type pairs such as .wasm=application/wasm,.br=application/x-brotli
+func (f contentTypeMapFlag) Set(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		ext, typ, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("%q is not in .ext=type form", pair)
+		}
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if ext == "." || strings.ContainsAny(ext[1:], "./") {
+			return fmt.Errorf("%q doesn't have a file extension such as .wasm", pair)
+		}
+		if _, _, err := mime.ParseMediaType(typ); err != nil {
+			return fmt.Errorf("%q doesn't have a valid MIME type: %w", pair, err)
+		}
+		if _, dup := f[ext]; dup {
+			return fmt.Errorf("extension %q is set more than once", ext)
+		}
+		f[ext] = typ
+	}
+	return nil
+}
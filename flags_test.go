@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr string
+	}{
+		{in: "50000000", want: 50_000_000},
+		{in: "0", want: 0},
+		{in: "512B", want: 512},
+		{in: "5KB", want: 5_000},
+		{in: "50MB", want: 50_000_000},
+		{in: "2GB", want: 2_000_000_000},
+		{in: "1TB", want: 1_000_000_000_000},
+		{in: "8KiB", want: 8 << 10},
+		{in: "64MiB", want: 64 << 20},
+		{in: "1GiB", want: 1 << 30},
+		{in: "1.5GB", want: 1_500_000_000},
+		{in: "1.5KiB", want: 1536},
+		{in: "50mb", want: 50_000_000},
+		{in: "50 MB", want: 50_000_000},
+		{in: "50M", wantErr: "ambiguous unit"},
+		{in: "1G", wantErr: "ambiguous unit"},
+		{in: "0.5B", wantErr: "not a whole number of bytes"},
+		{in: "0.1KiB", wantErr: "not a whole number of bytes"},
+		{in: "10000000TB", wantErr: "too large"},
+		{in: "9223372036854775808", wantErr: "not a size"},
+		{in: "50XB", wantErr: "unknown unit"},
+		{in: "MB", wantErr: "not a size"},
+		{in: "1.2.3MB", wantErr: "not a size"},
+		{in: "", wantErr: "not a size"},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseByteSize(%q) = %d, %v, want an error containing %q", tt.in, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
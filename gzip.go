@@ -0,0 +1,36 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// gzipReader reads the gzip compression of another reader, done in a goroutine
+type gzipReader struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+// gzipStream returns a reader of r compressed with gzip. As the compressed size
+// isn't known up front it is uploaded as a stream.
+func gzipStream(r io.Reader) *gzipReader {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		zw := gzip.NewWriter(pw)
+		_, err := io.Copy(zw, r)
+		if err == nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return &gzipReader{PipeReader: pr, done: done}
+}
+
+// Close stops the compression and waits until it no longer reads the source
+func (g *gzipReader) Close() error {
+	err := g.PipeReader.Close()
+	<-g.done
+	return err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// placeholder matches the {name} shorthand of a {{.name}} template action
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// parseKeyTemplate parses a -key-template. Placeholders are written {name}, the
+// text/template form {{.name}} works too.
+func parseKeyTemplate(text string) (*template.Template, error) {
+	t, err := template.New("key").Option("missingkey=error").Parse(placeholder.ReplaceAllString(text, "{{.$1}}"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid -key-template %q: %w", text, err)
+	}
+	// Expand it once so unknown placeholders are found before uploading
+	if _, err := expandKey(t, "file.txt", time.Now()); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// expandKey returns the key of the file at the slash-separated path rel, relative
+// to the uploaded directory or just the file name, uploaded at now
+func expandKey(t *template.Template, rel string, now time.Time) (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("cannot get hostname for -key-template: %w", err)
+	}
+	base := path.Base(rel)
+	ext := path.Ext(base)
+	now = now.UTC()
+	data := map[string]string{
+		"path":     rel,
+		"dir":      path.Dir(rel),
+		"basename": base,
+		"name":     strings.TrimSuffix(base, ext),
+		"ext":      strings.TrimPrefix(ext, "."),
+		"date":     now.Format("2006-01-02"),
+		"year":     now.Format("2006"),
+		"month":    now.Format("01"),
+		"day":      now.Format("02"),
+		"time":     now.Format("150405"),
+		"hostname": hostname,
+	}
+	var key strings.Builder
+	if err := t.Execute(&key, data); err != nil {
+		return "", fmt.Errorf("invalid -key-template: %w", err)
+	}
+	if key.Len() == 0 {
+		return "", fmt.Errorf("-key-template gives an empty key for %s", filepath.FromSlash(rel))
+	}
+	// Drop the ./ and // left by placeholders such as {dir} of a top-level file
+	return path.Clean(key.String()), nil
+}
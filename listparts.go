@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// listedPart is a part printed by -list-parts
+type listedPart struct {
+	PartNumber   int32     `json:"partNumber"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// runListParts prints the parts uploaded so far to the -list-parts upload of -key
+func runListParts(ctx context.Context, w io.Writer, u *uploader.Uploader, opts *options) error {
+	parts, err := u.ListParts(ctx, opts.key, opts.listParts)
+	if err != nil {
+		return err
+	}
+	listed := make([]listedPart, 0, len(parts))
+	var total int64
+	for _, part := range parts {
+		listed = append(listed, listedPart{
+			PartNumber:   aws.ToInt32(part.PartNumber),
+			Size:         aws.ToInt64(part.Size),
+			ETag:         aws.ToString(part.ETag),
+			LastModified: aws.ToTime(part.LastModified).UTC(),
+		})
+		total += aws.ToInt64(part.Size)
+	}
+
+	if opts.output == "json" {
+		return writeJSON(w, listed)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Part\tSize\tETag\tLast modified")
+	for _, part := range listed {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n", part.PartNumber, part.Size, part.ETag, part.LastModified.Format(time.RFC3339))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "Total: %d parts, %d bytes\n", len(listed), total)
+	return nil
+}
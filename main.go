@@ -1,212 +1,571 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
 	"os"
-	"sort"
-	"sync"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
 )
 
-// Constants defining AWS S3 details and file-related parameters
-const (
-	BucketName  = "your-bucket-name"
-	REGION      = "AWS_REGION"
-	FILE        = "/300MB.zip"
-	PartSize    = 50_000_000
-	RETRIES     = 3
-	SNSTopicARN = "arn:aws:sns:your-region:your-account-id:your-sns-topic-name"
-)
+// The main function, the entry point of the program
+func main() {
+	ctx, stop := signalContext()
+	defer stop()
 
-// Global variable to hold the AWS S3 session
-var s3session *s3.S3
+	opts, err := parseFlags(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
+	}
+	slog.SetDefault(newLogger(opts, os.Stderr))
 
-// Struct to store the result of a part upload
-type partUploadResult struct {
-	completedPart *s3.CompletedPart
-	err           error
+	if err := run(ctx, opts); err != nil {
+		stop()
+		msg := "upload failed"
+		if opts.verifyOnly {
+			msg = "verification failed"
+		}
+		slog.Error(msg, "error", err)
+		os.Exit(1)
+	}
 }
 
-// Global variables for wait group and channel synchronization
-var wg = sync.WaitGroup{}
-var ch = make(chan partUploadResult)
+// run performs the whole upload flow and returns the first error it hits
+func run(ctx context.Context, opts *options) error {
+	u := &uploader.Uploader{
+		Bucket:              opts.bucket,
+		PartSize:            opts.partSize,
+		Retries:             opts.retries,
+		Concurrency:         opts.concurrency,
+		MaxBufferMemory:     opts.maxBufferMemory,
+		ReadBufferSize:      opts.readBuffer,
+		MultipartThreshold:  opts.multipartThreshold,
+		Logger:              slog.Default(),
+		NoOverwrite:         !opts.overwrite,
+		KeepFailedUploads:   opts.noAbortOnFailure,
+		VerifyResumedParts:  opts.resumeVerify,
+		ComputeCRC32C:       opts.crc32c,
+		PartOrder:           uploader.PartOrder(opts.order),
+		ResumeParts:         opts.partRange,
+		RequestPayer:        requestPayer(opts),
+		ExpectedBucketOwner: opts.expectedBucketOwner,
+	}
+	if opts.stats {
+		u.StatsFunc = func(stats uploader.Stats) { printStats(os.Stderr, stats) }
+	}
+	if opts.maxBandwidth > 0 {
+		u.Limiter = uploader.NewBandwidthLimiter(opts.maxBandwidth)
+	}
+	if opts.hedge {
+		u.HedgeFactor = opts.hedgeFactor
+	}
+	if opts.maxRequestRate > 0 {
+		u.RequestLimiter = uploader.NewRequestLimiter(opts.maxRequestRate)
+	}
 
-// Initialization function to set up the AWS S3 session
-func init() {
-	// Create a new AWS S3 session
-	s3session = s3.New(session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(REGION),
-	})))
-}
+	// Only check that an upload would work
+	if opts.doctor {
+		cfg, err := loadAWSConfig(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return runDoctor(ctx, os.Stdout, cfg, opts)
+	}
 
-// The main function, the entry point of the program
-func main() {
-	// Get the current working directory and open the file for upload
-	currentDirectory, _ := os.Getwd()
-	file, _ := os.Open(currentDirectory + "/AWS/S3" + FILE)
-	defer file.Close()
+	// Only mint URLs, the bytes are uploaded by whoever gets them
+	if opts.presign {
+		cfg, err := loadAWSConfig(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return runPresign(ctx, os.Stdout, cfg, opts)
+	}
 
-	// Get file information and read its content into a buffer
-	stat, _ := file.Stat()
-	fileSize := stat.Size()
-	buffer := make([]byte, fileSize)
-	_, _ = file.Read(buffer)
+	// Only show what an unfinished upload holds, or abort it
+	if opts.listParts != "" {
+		cfg, err := loadAWSConfig(ctx, opts)
+		if err != nil {
+			return err
+		}
+		u.Client = newS3Client(cfg, opts)
+		return runListParts(ctx, os.Stdout, u, opts)
+	}
+	if opts.abort != "" || opts.abortAll {
+		cfg, err := loadAWSConfig(ctx, opts)
+		if err != nil {
+			return err
+		}
+		u.Client = newS3Client(cfg, opts)
+		return runAbort(ctx, os.Stdout, u, opts)
+	}
 
-	// Set an expiry date for the S3 upload
-	expiryDate := time.Now().AddDate(0, 0, 1)
+	// A directory is uploaded file by file under the key prefix
+	isDir := false
+	if opts.file != stdinFile && opts.manifest == "" && !opts.stdinList {
+		info, err := os.Stat(opts.file)
+		if err != nil {
+			return fmt.Errorf("cannot stat file: %s: %w", opts.file, err)
+		}
+		isDir = info.IsDir()
+	}
+	if isDir && opts.resume != "" {
+		return errors.New("-resume cannot be used when uploading a directory")
+	}
+	// -cleanup of a directory aborts the uploads of the keys under -prefix, which
+	// would be every key of the bucket without one, as with -key-template
+	if isDir && opts.cleanup && opts.prefix == "" {
+		return errors.New("-cleanup with a directory needs a -prefix, it would abort the uploads of every key in the bucket")
+	}
 
-	// Initiate a multipart upload and handle any errors
-	createdResp, err := s3session.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
-		Bucket:  aws.String(BucketName),
-		Key:     aws.String("TestVideo"),
-		Expires: &expiryDate,
-	})
+	// Only compare the file with the object already uploaded
+	if opts.verifyOnly {
+		if isDir {
+			return errors.New("-verify-only cannot be used with a directory")
+		}
+		cfg, err := loadAWSConfig(ctx, opts)
+		if err != nil {
+			return err
+		}
+		u.Client = newS3Client(cfg, opts)
+		return runVerify(ctx, os.Stdout, u, opts)
+	}
+	// A directory, a manifest and a list of paths are uploaded as a list of files
+	multiFile := isDir || opts.manifest != "" || opts.stdinList
+	var files []fileEntry
+	switch {
+	case opts.manifest != "":
+		var err error
+		if files, err = readManifest(opts.manifest); err != nil {
+			return err
+		}
+	case opts.stdinList:
+		var err error
+		if files, err = readPathList(os.Stdin, opts); err != nil {
+			return err
+		}
+	case isDir:
+		var err error
+		if files, err = directoryFiles(ctx, opts); err != nil {
+			return err
+		}
+	}
+
+	// Only print the plan, before anything talks to AWS
+	if opts.dryRun {
+		return printPlan(os.Stdout, u, opts, multiFile, files)
+	}
+
+	// Objects in cold storage are costly to get back, so make sure it is intended
+	if err := confirmCold(opts); err != nil {
+		return err
+	}
+
+	if opts.metricsAddr != "" {
+		stop, err := serveMetrics(opts.metricsAddr, u)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	// Load the AWS config for the configured region
+	cfg, err := loadAWSConfig(ctx, opts)
 	if err != nil {
-		fmt.Print(err)
-		return
+		return err
 	}
+	u.Client = newS3Client(cfg, opts)
 
-	var start, currentSize int
-	var remaining = int(fileSize)
-	var partNum = 1
-	var completedParts []*s3.CompletedPart
-
-	// Iterate over file parts and initiate parallel uploads
-	for start = 0; remaining > 0; start += PartSize {
-		wg.Add(1)
-		if remaining < PartSize {
-			currentSize = remaining
-		} else {
-			currentSize = PartSize
-		}
-		// Start a goroutine to upload a part to S3
-		go uploadToS3(createdResp, buffer[start:start+currentSize], partNum, &wg)
-
-		remaining -= currentSize
-		fmt.Printf("Uplaodind of part %v started and remaning is %v \n", partNum, remaining)
-		partNum++
-	}
-
-	// Close the channel when all uploads are finished
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
-
-	// Process the results from the channel and handle errors
-	for result := range ch {
-		if result.err != nil {
-			// Abort the multipart upload in case of an error and handle any errors
-			_, err = s3session.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
-				Bucket:   aws.String(BucketName),
-				Key:      aws.String(file.Name()),
-				UploadId: createdResp.UploadId,
-			})
-			if err != nil {
-				fmt.Print(err)
-				os.Exit(1)
-			}
-			// Notify on upload failure using SNS
-			sendSNSNotification("Upload Failed", fmt.Sprintf("Error: %v", result.err))
-		} else {
-			fmt.Printf("Uploading of part %v has been finished \n", *result.completedPart.PartNumber)
-			completedParts = append(completedParts, result.completedPart)
-		}
-	}
-
-	// Order the array based on the PartNumber as each part could be uploaded in a different order
-	sort.Slice(completedParts, func(i, j int) bool {
-		return *completedParts[i].PartNumber < *completedParts[j].PartNumber
-	})
+	// Set up the notifier once, for the whole run
+	notifier := newNotifier(cfg, opts)
 
-	if len(completedParts) == 0 {
-		// Notify on upload failure if no parts were successfully uploaded
-		sendSNSNotification("Upload Failed", "No parts were successfully uploaded.")
-		return
+	// Bound everything talking to S3 from here on. An expired upload is aborted
+	// like a cancelled one, but reported as a failure.
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
 	}
 
-	// Signal AWS S3 that the multipart upload is finished
-	resp, err := s3session.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
-		Bucket:   createdResp.Bucket,
-		Key:      createdResp.Key,
-		UploadId: createdResp.UploadId,
-		MultipartUpload: &s3.CompletedMultipartUpload{
-			Parts: completedParts,
-		},
-	})
+	// Abort stale uploads of the key left behind by earlier runs
+	if opts.cleanup {
+		prefix := opts.key
+		if isDir {
+			prefix = opts.prefix
+		}
+		aborted, err := u.AbortStale(ctx, prefix, opts.cleanupAge)
+		if err != nil {
+			return err
+		}
+		slog.Info("aborted unfinished multipart uploads", "count", aborted, "older_than", opts.cleanupAge)
+	}
 
+	if multiFile {
+		return runFiles(ctx, u, notifier, opts, files)
+	}
+
+	start := time.Now()
+	resp, t, err := uploadFile(ctx, u, opts, opts.file, opts.key)
+	err = accelerateError(opts, err)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+		err = fmt.Errorf("upload did not finish within -timeout %s: %w", opts.timeout, err)
+	}
+	if opts.output == "json" {
+		if err := writeJSON(os.Stdout, newSummary(opts.bucket, opts.key, resp, t, start, err)); err != nil {
+			slog.Error("cannot print upload summary", "error", err)
+		}
+	}
 	if err != nil {
-		fmt.Print(err)
-		// Notify on upload failure using SNS
-		sendSNSNotification("Upload Failed", fmt.Sprintf("Error completing upload: %v", err))
-		return
-	} else {
-		fmt.Println(resp.String())
-		// Notify on successful upload using SNS
-		sendSNSNotification("Upload Successful", "Multipart upload completed successfully.")
-	}
-}
-
-// Function to upload a part to AWS S3
-func uploadToS3(resp *s3.CreateMultipartUploadOutput, fileBytes []byte, partNum int, wg *sync.WaitGroup) {
-	defer wg.Done()
-	var try int
-	fmt.Printf("Uploading %v \n", len(fileBytes))
-	for try <= RETRIES {
-		uploadRes, err := s3session.UploadPart(&s3.UploadPartInput{
-			Body:          bytes.NewReader(fileBytes),
-			Bucket:        resp.Bucket,
-			Key:           resp.Key,
-			PartNumber:    aws.Int64(int64(partNum)),
-			UploadId:      resp.UploadId,
-			ContentLength: aws.Int64(int64(len(fileBytes))),
-		})
+		// A cancelled upload has already been aborted, there is nothing to report
+		if canceled(ctx) {
+			return err
+		}
+		// Notify on upload failure
+		notify(ctx, notifier, "Upload Failed", failureMessage(opts, err))
+		return err
+	}
+
+	if t.skipped {
+		slog.Info("skipped (already uploaded)", "bucket", opts.bucket, "key", opts.key, "etag", aws.ToString(resp.ETag))
+		notify(ctx, notifier, "Upload Skipped", "The object is already uploaded with the same content.")
+		return nil
+	}
+	attrs := []any{"bucket", aws.ToString(resp.Bucket), "key", aws.ToString(resp.Key), "etag", aws.ToString(resp.ETag)}
+	if t.crc32c != "" {
+		attrs = append(attrs, "crc32c", t.crc32c)
+	}
+	if t.sha256 != "" {
+		attrs = append(attrs, "sha256", t.sha256)
+	}
+	slog.Info("upload completed", attrs...)
+	// Notify on successful upload
+	notify(ctx, notifier, "Upload Successful", "Upload completed successfully.")
+	return nil
+}
+
+// signalContext returns a context cancelled when the user hits Ctrl+C or the
+// container is stopped, the multipart upload is then aborted before exiting
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// canceled reports whether the run was cancelled by the user, as opposed to
+// -timeout expiring
+func canceled(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// uploadFile uploads the file at path to key, reading stdin when path is "-". What
+// was sent is returned along with the result.
+func uploadFile(ctx context.Context, u *uploader.Uploader, opts *options, path, key string) (*s3.CompleteMultipartUploadOutput, transfer, error) {
+	// Upload with a copy of u that also captures the stats of this upload, and
+	// logs its progress on its own as files of a directory can run in parallel
+	var t transfer
+	fileUploader := *u
+	fileUploader.ProgressFunc = newProgressPrinter(key, progressBar(opts)).print
+	statsFunc := u.StatsFunc
+	fileUploader.StatsFunc = func(stats uploader.Stats) {
+		t.retries = stats.Retries()
+		t.crc32c = stats.CRC32C
+		if statsFunc != nil {
+			statsFunc(stats)
+		}
+	}
+	u = &fileUploader
+
+	// Look up the object at the key once for -dedupe and -overwrite=false
+	var existing *s3.HeadObjectOutput
+	if opts.dedupe || !opts.overwrite {
+		var err error
+		if existing, err = headObject(ctx, u, key); err != nil {
+			return nil, t, err
+		}
+	}
+
+	if path == stdinFile {
+		if err := refuseOverwrite(opts, key, existing); err != nil {
+			return nil, t, err
+		}
+		// There is no file name to go by, so the type is guessed from the key
+		objOpts := append(objectOptions(opts), uploader.WithContentType(contentType(opts, key, nil)))
+		var src io.Reader = os.Stdin
+		if opts.gzip {
+			z := gzipStream(os.Stdin)
+			defer z.Close()
+			src = z
+		}
+		stdin := &countingReader{r: src}
+		resp, err := u.UploadStream(ctx, key, stdin, objOpts...)
+		t.size = stdin.n
+		return resp, t, err
+	}
+
+	// Open the file for upload
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, t, fmt.Errorf("cannot open file: %s: %w", path, err)
+	}
+	defer file.Close()
+
+	// Get file information, parts are read straight from the file later on
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, t, fmt.Errorf("cannot stat file: %s: %w", path, err)
+	}
+	objOpts := append(objectOptions(opts), uploader.WithContentType(contentType(opts, path, file)))
+	if opts.dedupe || opts.hash {
+		// Skip content that is already at the key, and record the hash for the next
+		// run and as a trail from the local content to the object
+		sum, err := fileSHA256(file, stat.Size())
 		if err != nil {
-			fmt.Println(err)
-			if try == RETRIES {
-				ch <- partUploadResult{nil, err}
-				return
-			} else {
-				try++
-				time.Sleep(time.Duration(time.Second * 15))
-			}
-		} else {
-			ch <- partUploadResult{
-				&s3.CompletedPart{
-					ETag:       uploadRes.ETag,
-					PartNumber: aws.Int64(int64(partNum)),
-				}, nil,
-			}
-			return
-		}
-	}
-	ch <- partUploadResult{}
-}
-
-// Function to send SNS notifications
-func sendSNSNotification(subject, message string) {
-	// Create a new session for SNS
-	snsSession := session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(REGION),
-	}))
-
-	// Create an SNS client
-	snsClient := sns.New(snsSession)
-
-	// Publish a message to the specified SNS topic
-	_, err := snsClient.Publish(&sns.PublishInput{
-		Message:  aws.String(message),
-		Subject:  aws.String(subject),
-		TopicArn: aws.String(SNSTopicARN),
+			return nil, t, err
+		}
+		if opts.dedupe && sameContent(existing, sum) {
+			t.skipped = true
+			return &s3.CompleteMultipartUploadOutput{
+				Bucket:    aws.String(opts.bucket),
+				Key:       aws.String(key),
+				ETag:      existing.ETag,
+				VersionId: existing.VersionId,
+			}, t, nil
+		}
+		objOpts = append(objOpts, uploader.WithMetadata(map[string]string{sha256MetadataKey: sum}))
+		if opts.hash {
+			t.sha256 = sum
+			slog.Info("uploading file", "path", path, "key", key, "sha256", sum)
+		}
+	}
+	if err := refuseOverwrite(opts, key, existing); err != nil {
+		return nil, t, err
+	}
+	if opts.gzip {
+		// The compressed parts are streamed as their offsets aren't known up front
+		z := gzipStream(file)
+		defer z.Close()
+		compressed := &countingReader{r: z}
+		resp, err := u.UploadStream(ctx, key, compressed, objOpts...)
+		t.size = compressed.n
+		return resp, t, err
+	}
+	t.size = stat.Size()
+	if opts.resume != "" {
+		resp, err := u.Resume(ctx, key, opts.resume, file, stat.Size(), objOpts...)
+		return resp, t, err
+	}
+	resp, err := u.Upload(ctx, key, file, stat.Size(), objOpts...)
+	return resp, t, err
+}
+
+// failureMessage describes a failed upload in its notification, with the ID of
+// the multipart upload when one was created
+func failureMessage(opts *options, err error) string {
+	msg := fmt.Sprintf("Error: %v", err)
+	var uploadErr *uploader.UploadError
+	if errors.As(err, &uploadErr) {
+		msg += fmt.Sprintf("\nBucket: %s\nKey: %s\nUpload ID: %s", opts.bucket, opts.key, uploadErr.UploadID)
+		if opts.noAbortOnFailure {
+			msg += "\nThe upload was kept, list its parts with -list-parts, continue it with -resume or abort it with -abort."
+		}
+	}
+	return msg
+}
+
+// requestPayer returns who pays for the requests: the caller with -request-payer,
+// or else the bucket owner
+func requestPayer(opts *options) types.RequestPayer {
+	if opts.requestPayer {
+		return types.RequestPayerRequester
+	}
+	return ""
+}
+
+// nonEmpty returns a pointer to s, or nil when s is empty so the field isn't sent
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// refuseOverwrite fails when an object exists at key and -overwrite isn't set.
+// Another writer can still create the key between this check and the end of the
+// upload, uploader.NoOverwrite catches that on backends with conditional writes.
+func refuseOverwrite(opts *options, key string, existing *s3.HeadObjectOutput) error {
+	if existing != nil && !opts.overwrite {
+		return fmt.Errorf("object %s already exists in bucket %s, set -overwrite to replace it", key, opts.bucket)
+	}
+	return nil
+}
+
+// objectOptions returns the object settings requested on the command line that
+// are the same for every uploaded file
+func objectOptions(opts *options) []uploader.ObjectOption {
+	var objOpts []uploader.ObjectOption
+	if opts.sse != "" {
+		objOpts = append(objOpts, uploader.WithServerSideEncryption(types.ServerSideEncryption(opts.sse), opts.kmsKeyID))
+	}
+	if len(opts.kmsContext) > 0 {
+		objOpts = append(objOpts, uploader.WithEncryptionContext(opts.kmsContext))
+	}
+	if opts.storageClass != "" {
+		objOpts = append(objOpts, uploader.WithStorageClass(types.StorageClass(opts.storageClass)))
+	}
+	if opts.acl != "" {
+		objOpts = append(objOpts, uploader.WithACL(types.ObjectCannedACL(opts.acl)))
+	}
+	if opts.objectLockMode != "" {
+		objOpts = append(objOpts, uploader.WithRetention(types.ObjectLockMode(opts.objectLockMode), opts.retainUntil))
+	}
+	if opts.legalHold {
+		objOpts = append(objOpts, uploader.WithLegalHold())
+	}
+	if opts.gzip {
+		objOpts = append(objOpts, uploader.WithContentEncoding("gzip"))
+	}
+	if opts.checksumAlgorithm != "" {
+		objOpts = append(objOpts, uploader.WithChecksumAlgorithm(types.ChecksumAlgorithm(opts.checksumAlgorithm)))
+	}
+	if opts.cacheControl != "" {
+		objOpts = append(objOpts, uploader.WithCacheControl(opts.cacheControl))
+	}
+	if opts.contentDisposition != "" {
+		objOpts = append(objOpts, uploader.WithContentDisposition(opts.contentDisposition))
+	}
+	if !opts.expires.IsZero() {
+		objOpts = append(objOpts, uploader.WithExpires(opts.expires))
+	}
+	if len(opts.metadata) > 0 {
+		objOpts = append(objOpts, uploader.WithMetadata(opts.metadata))
+	}
+	if len(opts.tags) > 0 {
+		objOpts = append(objOpts, uploader.WithTags(opts.tags))
+	}
+	return objOpts
+}
+
+// contentType returns the -content-type override, or else the MIME type of the
+// extension of name in -content-type-map or known to the system, or else the type
+// sniffed from the first bytes of r
+func contentType(opts *options, name string, r io.ReaderAt) string {
+	if opts.contentType != "" {
+		return opts.contentType
+	}
+	ext := filepath.Ext(name)
+	if t, ok := opts.contentTypeMap[strings.ToLower(ext)]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	if r == nil {
+		return defaultContentType
+	}
+	head := make([]byte, 512)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return defaultContentType
+	}
+	return http.DetectContentType(head[:n])
+}
+
+// newLogger creates the logger selected by -log-level and -log-format
+func newLogger(opts *options, w io.Writer) *slog.Logger {
+	handlerOpts := &slog.HandlerOptions{Level: opts.logLevel}
+	if opts.logFormat == "json" {
+		return slog.New(slog.NewJSONHandler(w, handlerOpts))
+	}
+	return slog.New(slog.NewTextHandler(w, handlerOpts))
+}
+
+// newS3Client creates the S3 client, pointed at a custom endpoint such as MinIO when one is set
+func newS3Client(cfg aws.Config, opts *options) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.endpointURL != "" {
+			o.BaseEndpoint = aws.String(opts.endpointURL)
+		}
+		o.UsePathStyle = opts.forcePathStyle
+		o.UseAccelerate = opts.accelerate
 	})
+}
 
+// accelerateError explains an error S3 returns for -accelerate on a bucket
+// without Transfer Acceleration, other errors are returned as they are
+func accelerateError(opts *options, err error) error {
+	var apiErr smithy.APIError
+	if opts.accelerate && errors.As(err, &apiErr) && strings.Contains(apiErr.ErrorMessage(), "Transfer Acceleration") {
+		return fmt.Errorf("bucket %s doesn't have Transfer Acceleration enabled, enable it or run without -accelerate: %w", opts.bucket, err)
+	}
+	return err
+}
+
+// loadAWSConfig loads the AWS config, leaving the region to the SDK defaults when not set.
+// The credentials come from -profile when set, and are exchanged for the ones of
+// -assume-role-arn when set. Both the S3 and SNS clients use the resulting config.
+// The SDK retries requests -sdk-max-retries times, none by default, so that the
+// retries of the uploader are the only ones.
+func loadAWSConfig(ctx context.Context, opts *options) (aws.Config, error) {
+	loadOpts := []func(*config.LoadOptions) error{
+		config.WithRetryMaxAttempts(opts.sdkMaxRetries + 1),
+	}
+	if opts.region != "" {
+		loadOpts = append(loadOpts, config.WithRegion(opts.region))
+	}
+	if opts.profile != "" {
+		loadOpts = append(loadOpts, config.WithSharedConfigProfile(opts.profile))
+	}
+	loadOpts = append(loadOpts, config.WithHTTPClient(httpClient(opts)))
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
 	if err != nil {
-		fmt.Printf("Error sending SNS notification: %v\n", err)
+		return aws.Config{}, fmt.Errorf("cannot load AWS config: %w", err)
+	}
+
+	// Assume the role with the credentials loaded above, the cache refreshes them before they expire
+	if opts.assumeRoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), opts.assumeRoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "go-s3-uploader"
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg, nil
+}
+
+// httpClient returns the client of the AWS requests with the -http-proxy and
+// -http-timeout settings. It keeps a connection to S3 open for each part in
+// flight, where the default transport keeps 10, so that parts don't reconnect.
+func httpClient(opts *options) *awshttp.BuildableClient {
+	idleConns := opts.concurrency * opts.parallelFiles
+	client := awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		if opts.httpProxy != nil {
+			tr.Proxy = http.ProxyURL(opts.httpProxy)
+		}
+		tr.MaxIdleConnsPerHost = max(tr.MaxIdleConnsPerHost, idleConns)
+	})
+	if opts.httpTimeout > 0 {
+		client = client.WithTimeout(opts.httpTimeout)
 	}
+	return client
 }
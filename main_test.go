@@ -0,0 +1,15 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRunRejectsDirectoryCleanupWithoutPrefix(t *testing.T) {
+	opts := &options{bucket: "bucket", file: t.TempDir(), cleanup: true, parallelFiles: 1}
+	err := run(context.Background(), opts)
+	if err == nil || !strings.Contains(err.Error(), "-cleanup with a directory needs a -prefix") {
+		t.Errorf("run error = %v, want the -cleanup error", err)
+	}
+}
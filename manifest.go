@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// readManifest reads the files listed by -manifest, one localpath<TAB>s3key entry
+// per line. Blank lines and lines starting with # are skipped.
+func readManifest(path string) ([]fileEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open manifest: %w", err)
+	}
+	defer f.Close()
+
+	var files []fileEntry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		localPath, key, ok := strings.Cut(text, "\t")
+		if !ok || localPath == "" || key == "" {
+			return nil, fmt.Errorf("invalid manifest %s line %d: must be localpath<TAB>s3key", path, line)
+		}
+		files = append(files, fileEntry{path: localPath, key: key})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read manifest: %s: %w", path, err)
+	}
+	return files, nil
+}
+
+// readPathList reads the files listed by -stdin-list, one local path per line as
+// printed by find, keyed like the files of a directory by their cleaned path.
+// Lines are taken whole, so paths may hold spaces; blank lines and directories
+// are skipped.
+func readPathList(r io.Reader, opts *options) ([]fileEntry, error) {
+	var files []fileEntry
+	// Every key is expanded with the same date, like the files of a directory
+	now := time.Now()
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		p := strings.TrimSuffix(scanner.Text(), "\r")
+		if p == "" {
+			continue
+		}
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			slog.Debug("skipped directory of -stdin-list", "path", p)
+			continue
+		}
+		// An absolute path is keyed without its leading /, as find / prints them
+		rel := strings.TrimPrefix(filepath.Clean(p), string(filepath.Separator))
+		if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("invalid -stdin-list line %d: %s is outside the current directory, list it by its absolute path instead", line, p)
+		}
+		key, err := fileKey(opts, rel, now)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, fileEntry{path: p, key: key})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read -stdin-list: %w", err)
+	}
+	return files, nil
+}
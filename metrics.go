@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+	"github.com/TahjibNil75/go-s3-uploader/uploader/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serveMetrics has u export its uploads as Prometheus metrics, served on addr at
+// /metrics until the returned function is called
+func serveMetrics(addr string, u *uploader.Uploader) (func(), error) {
+	reg := prometheus.NewRegistry()
+	m, err := metrics.New(reg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot register metrics: %w", err)
+	}
+	u.Observer = m
+
+	// Listen right away so a taken address fails the run instead of the scrapes
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot serve metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("cannot serve metrics", "error", err)
+		}
+	}()
+	slog.Info("serving metrics", "address", ln.Addr().String())
+	return func() { srv.Close() }, nil
+}
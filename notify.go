@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// Notifier sends a notification about the upload result
+type Notifier interface {
+	Notify(ctx context.Context, subject, message string) error
+}
+
+// newNotifier creates the notifier selected by -notify. SNS sends nothing when
+// no topic is configured.
+func newNotifier(cfg aws.Config, opts *options) Notifier {
+	switch opts.notify {
+	case "webhook":
+		return NewWebhookNotifier(opts.webhookURL)
+	case "sns":
+		if opts.snsTopic != "" {
+			return NewSNSNotifier(cfg, opts.snsTopic, opts.snsAttributes)
+		}
+	}
+	return NoopNotifier{}
+}
+
+// Attempts and timeout of each attempt of sending a notification
+const (
+	notifyAttempts = 3
+	notifyTimeout  = 10 * time.Second
+)
+
+// notify sends a notification with n, retrying failed attempts with the same
+// backoff as the S3 requests. Errors are only logged as a failed notification
+// must not fail the upload, and the payload is logged along with them so it
+// isn't lost. The notification is sent even when ctx expired, as it reports the
+// upload that timed out.
+func notify(ctx context.Context, n Notifier, subject, message string) {
+	ctx = context.WithoutCancel(ctx)
+	var err error
+	for attempt := 1; attempt <= notifyAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(uploader.Backoff(attempt - 1))
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		err = n.Notify(attemptCtx, subject, message)
+		cancel()
+		if err == nil {
+			return
+		}
+		slog.Warn("notification attempt failed", "attempt", attempt, "error", err)
+	}
+	slog.Error("cannot send notification", "error", err, "subject", subject, "message", message)
+}
+
+// SNSNotifier publishes notifications to an SNS topic
+type SNSNotifier struct {
+	client   *sns.Client
+	topicARN string
+	// String message attributes of every notification, for subscription filters
+	attributes map[string]types.MessageAttributeValue
+}
+
+// NewSNSNotifier creates a notifier sharing the region and credentials of the S3
+// client. The attributes are sent with every message.
+func NewSNSNotifier(cfg aws.Config, topicARN string, attributes map[string]string) *SNSNotifier {
+	n := &SNSNotifier{
+		client:   sns.NewFromConfig(cfg),
+		topicARN: topicARN,
+	}
+	if len(attributes) > 0 {
+		n.attributes = make(map[string]types.MessageAttributeValue, len(attributes))
+		for name, value := range attributes {
+			n.attributes[name] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+		}
+	}
+	return n
+}
+
+// Longest subject SNS publishes, which must be less than 100 characters
+const maxSNSSubject = 99
+
+// snsSubject returns subject as SNS accepts it: printable ASCII on a single line,
+// with ? for the other characters, and cut to maxSNSSubject characters. changed
+// reports whether it differs, the message then starts with the whole subject.
+func snsSubject(subject string) (s string, changed bool) {
+	s = strings.Join(strings.FieldsFunc(subject, unicode.IsControl), " ")
+	s = strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return '?'
+		}
+		return r
+	}, s)
+	if runes := []rune(s); len(runes) > maxSNSSubject {
+		s = string(runes[:maxSNSSubject-3]) + "..."
+	}
+	return s, s != subject
+}
+
+// Notify publishes a message to the topic
+func (n *SNSNotifier) Notify(ctx context.Context, subject, message string) error {
+	// SNS rejects the whole message over a subject it doesn't accept
+	snsSubj, changed := snsSubject(subject)
+	if changed {
+		message = subject + "\n\n" + message
+	}
+	_, err := n.client.Publish(ctx, &sns.PublishInput{
+		Message:           aws.String(message),
+		Subject:           aws.String(snsSubj),
+		TopicArn:          aws.String(n.topicARN),
+		MessageAttributes: n.attributes,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot send SNS notification: %w", err)
+	}
+	return nil
+}
+
+// Timeout of a webhook request, including reading the response
+const webhookTimeout = 10 * time.Second
+
+// WebhookNotifier POSTs notifications as JSON to a URL. The body has a "text"
+// field, so Slack incoming webhooks take it as is.
+type WebhookNotifier struct {
+	client *http.Client
+	url    string
+}
+
+// NewWebhookNotifier creates a notifier posting to url
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		client: &http.Client{Timeout: webhookTimeout},
+		url:    url,
+	}
+}
+
+// webhookPayload is the JSON body sent by WebhookNotifier
+type webhookPayload struct {
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+	Text    string `json:"text"`
+}
+
+// Notify POSTs the notification and fails on any response other than a 2xx
+func (n *WebhookNotifier) Notify(ctx context.Context, subject, message string) error {
+	body, err := json.Marshal(webhookPayload{
+		Subject: subject,
+		Message: message,
+		Text:    subject + ": " + message,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot send webhook notification: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send webhook notification: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("cannot send webhook notification: %s returned %s", n.url, resp.Status)
+	}
+	return nil
+}
+
+// NoopNotifier sends nothing
+type NoopNotifier struct{}
+
+// Notify does nothing
+func (NoopNotifier) Notify(context.Context, string, string) error {
+	return nil
+}
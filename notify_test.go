@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestSNSSubject(t *testing.T) {
+	tests := []struct {
+		name        string
+		subject     string
+		want        string
+		wantChanged bool
+	}{
+		{"short", "Upload Failed", "Upload Failed", false},
+		{"99 characters", strings.Repeat("a", 99), strings.Repeat("a", 99), false},
+		{"100 characters", strings.Repeat("a", 100), strings.Repeat("a", 96) + "...", true},
+		{"150 characters", strings.Repeat("a", 150), strings.Repeat("a", 96) + "...", true},
+		{"non-ASCII", "Upload Failed: rapport-été.csv", "Upload Failed: rapport-?t?.csv", true},
+		{"150 non-ASCII characters", strings.Repeat("é", 150), strings.Repeat("?", 96) + "...", true},
+		{"newline", "Upload Failed\nfor key", "Upload Failed for key", true},
+		{"control characters", "Upload\r\n\tFailed", "Upload Failed", true},
+	}
+	for _, tt := range tests {
+		got, changed := snsSubject(tt.subject)
+		if got != tt.want || changed != tt.wantChanged {
+			t.Errorf("%s: snsSubject = %q, %v, want %q, %v", tt.name, got, changed, tt.want, tt.wantChanged)
+		}
+		if len(got) >= 100 {
+			t.Errorf("%s: snsSubject is %d characters long, want less than 100", tt.name, len(got))
+		}
+		for _, r := range got {
+			if r > unicode.MaxASCII {
+				t.Errorf("%s: snsSubject %q isn't ASCII", tt.name, got)
+				break
+			}
+		}
+	}
+}
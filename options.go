@@ -0,0 +1,650 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Default values for the command-line flags
+const (
+	DefaultRetries    = 3
+	DefaultCleanupAge = 24 * time.Hour
+	// Validity of the URLs printed by -presign
+	DefaultPresignExpiry = 15 * time.Minute
+)
+
+// errUsage is returned for a command line the flag package couldn't parse
+var errUsage = errors.New("invalid command line")
+
+// Value of -file that reads the upload from stdin
+const stdinFile = "-"
+
+// Suffix added to the default keys of -gzip uploads
+const gzipSuffix = ".gz"
+
+// Content-Type of objects whose type can't be detected
+const defaultContentType = "application/octet-stream"
+
+// Limits of the tags of an object, whose lengths S3 counts in characters
+const (
+	maxTags           = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// Checksum algorithms accepted by -checksum-algorithm
+var checksumAlgorithms = []types.ChecksumAlgorithm{
+	types.ChecksumAlgorithmCrc32,
+	types.ChecksumAlgorithmCrc32c,
+	types.ChecksumAlgorithmSha1,
+	types.ChecksumAlgorithmSha256,
+}
+
+// options holds everything the upload needs, as set on the command line
+type options struct {
+	bucket string
+	region string
+
+	// Credentials: a named profile of the shared config and a role to assume with it
+	profile       string
+	assumeRoleARN string
+
+	// Custom S3-compatible endpoint, such as MinIO or Wasabi
+	endpointURL    string
+	forcePathStyle bool
+	// Upload through the S3 Transfer Acceleration endpoint
+	accelerate bool
+	// Pay for the requests to a requester-pays bucket
+	requestPayer bool
+	// AWS account ID the bucket must belong to
+	expectedBucketOwner string
+
+	file     string
+	key      string
+	partSize int64
+	retries  int
+	// Parts of a file uploaded at the same time
+	concurrency int
+	// Retries of each request made by the SDK itself, under the ones of -retries
+	sdkMaxRetries int
+	// Upload bandwidth cap in bytes per second, 0 is unlimited
+	maxBandwidth int64
+	// Cap of the requests creating objects per second across all files, 0 is unlimited
+	maxRequestRate float64
+	// Cap of the bytes of the parts in flight, 0 is unlimited
+	maxBufferMemory int64
+	// Size of the aligned chunks the parts of a file are read in, 0 reads them as they are sent
+	readBuffer int64
+	// Send straggling parts a second time, once they took hedgeFactor times the median part
+	hedge       bool
+	hedgeFactor float64
+	// Order in which the parts of a file are started
+	order    string
+	snsTopic string
+	// Message attributes of the SNS notifications, for the filters of subscriptions
+	snsAttributes keyValueFlag
+	resume        string
+	prefix        string
+	// File listing localpath<TAB>s3key entries to upload instead of -file
+	manifest string
+	// Upload the local paths read from stdin, one per line, instead of -file
+	stdinList bool
+	// Files of a directory or a manifest uploaded at the same time
+	parallelFiles int
+	// Stop starting files after the first failed one
+	failFast bool
+	// Upload the targets of the symlinks of a directory instead of skipping them
+	followSymlinks bool
+	dryRun         bool
+
+	// Template of the keys, used instead of -key and -prefix
+	keyTemplate *template.Template
+
+	// Notifier of the result: sns, webhook or none
+	notify     string
+	webhookURL string
+
+	// Logging setup
+	logLevel  slog.Level
+	logFormat string
+
+	// Skip files whose content is already at the key
+	dedupe bool
+	// Log the SHA256 of each file and store it in the object metadata
+	hash bool
+
+	// Only check the uploaded object against the file
+	verifyOnly bool
+	// Check the parts already uploaded against the file on -resume
+	resumeVerify bool
+	// Parts uploaded again on -resume, all the missing ones when nil
+	partRange *uploader.PartRange
+
+	// Replace existing objects instead of failing
+	overwrite bool
+
+	// Leave failed multipart uploads on S3 instead of aborting them
+	noAbortOnFailure bool
+
+	// Check the setup instead of uploading
+	doctor bool
+
+	// Print presigned URLs instead of uploading
+	presign       bool
+	presignExpiry time.Duration
+	presignParts  int
+
+	// Print the parts of this multipart upload instead of uploading
+	listParts string
+	// Abort this multipart upload, or every one under -prefix, instead of uploading
+	abort    string
+	abortAll bool
+
+	// Format of the result printed to stdout: text or json
+	output string
+	// Print the throughput of the parts once uploaded
+	stats bool
+	// Address serving Prometheus metrics during the run
+	metricsAddr string
+
+	// Abort unfinished uploads of the key older than cleanupAge before uploading
+	cleanup    bool
+	cleanupAge time.Duration
+
+	// Maximum duration of the whole upload, 0 is unbounded
+	timeout time.Duration
+	// Proxy of the AWS requests, and maximum duration of each of them
+	httpProxy   *url.URL
+	httpTimeout time.Duration
+
+	// Files smaller than this are uploaded with a single PutObject
+	multipartThreshold int64
+
+	// Settings of the uploaded object
+	contentType string
+	// MIME types of the files by extension, before the detected ones
+	contentTypeMap contentTypeMapFlag
+	gzip           bool
+	sse            string
+	kmsKeyID       string
+	kmsContext     keyValueFlag
+	metadata       keyValueFlag
+	tags           keyValueFlag
+
+	storageClass string
+	// Upload to GLACIER or DEEP_ARCHIVE without asking
+	confirmCold bool
+	acl         string
+	// HTTP headers returned with the object
+	expires            time.Time
+	cacheControl       string
+	contentDisposition string
+
+	// Object Lock retention and legal hold
+	objectLockMode string
+	retainUntil    time.Time
+	legalHold      bool
+
+	// Additional checksum S3 verifies the parts and the object with
+	checksumAlgorithm string
+	// Compute the CRC32C of the whole object for the result
+	crc32c bool
+}
+
+// parseFlags reads the command-line flags into options and validates them
+func parseFlags(args []string, output io.Writer) (*options, error) {
+	opts := &options{
+		metadata:       keyValueFlag{},
+		tags:           keyValueFlag{},
+		kmsContext:     keyValueFlag{},
+		contentTypeMap: contentTypeMapFlag{},
+		snsAttributes:  keyValueFlag{},
+	}
+
+	var keyTemplate, configPath string
+	fs := flag.NewFlagSet("go-s3-uploader", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&configPath, "config", "", "YAML file setting flags by name, such as bucket: NAME or part-size: 100000000, overridden by the command line")
+	fs.StringVar(&opts.bucket, "bucket", "", "name of the destination S3 bucket (required)")
+	fs.StringVar(&opts.region, "region", "", "AWS region of the bucket (defaults to the AWS config)")
+	fs.StringVar(&opts.profile, "profile", "", "named profile of the AWS shared config and credentials files")
+	fs.StringVar(&opts.assumeRoleARN, "assume-role-arn", "", "ARN of an IAM role to assume, such as one in the account of the bucket")
+	fs.StringVar(&opts.endpointURL, "endpoint-url", "", "URL of an S3-compatible endpoint such as MinIO or Wasabi (SNS keeps using AWS, leave -sns-topic unset when there is none)")
+	fs.BoolVar(&opts.forcePathStyle, "force-path-style", false, "address the bucket in the URL path instead of the host name, needed by MinIO")
+	fs.BoolVar(&opts.requestPayer, "request-payer", false, "upload to a requester-pays bucket, the requests and the transfer are billed to the caller instead of the bucket owner")
+	fs.StringVar(&opts.expectedBucketOwner, "expected-bucket-owner", "", "ID of the AWS account the bucket must belong to, every request fails when it belongs to another one")
+	fs.BoolVar(&opts.accelerate, "accelerate", false, "upload through the S3 Transfer Acceleration endpoint, which must be enabled on the bucket (not with -endpoint-url or -force-path-style)")
+	fs.StringVar(&opts.file, "file", "", "path of the local file or directory to upload, - reads from stdin (required)")
+	fs.StringVar(&opts.key, "key", "", "S3 object key (defaults to the file's base name)")
+	fs.Var(byteSizeFlag{&opts.partSize}, "part-size", "`size` of each uploaded part, in bytes or with a unit such as 64MiB or 50MB, at least 5MiB (default 50MB, larger for files over 10000 parts)")
+	fs.IntVar(&opts.retries, "retries", DefaultRetries, "number of retries for a failed part")
+	fs.IntVar(&opts.concurrency, "concurrency", uploader.DefaultConcurrency, "number of parts of a file uploaded at the same time, shared by the files of -parallel-files")
+	fs.IntVar(&opts.sdkMaxRetries, "sdk-max-retries", 0, "number of retries of each request by the AWS SDK itself; every -retries attempt can make up to this many more, so a failing part is sent (retries+1)*(sdk-max-retries+1) times")
+	fs.Int64Var(&opts.maxBandwidth, "max-bandwidth", 0, "maximum upload rate in bytes per second across all parts (0 is unlimited)")
+	fs.Float64Var(&opts.maxRequestRate, "max-request-rate", 0, "maximum CreateMultipartUpload, CompleteMultipartUpload and PutObject requests per second across all files, against 503 SlowDown on bulk uploads; parts aren't limited (0 is unlimited)")
+	fs.Var(byteSizeFlag{&opts.maxBufferMemory}, "max-buffer-memory", "maximum `size` of the parts in flight, such as 1GiB, the concurrency is lowered to fit large parts (0 is unlimited)")
+	fs.Var(byteSizeFlag{&opts.readBuffer}, "read-buffer", "read the parts of a file in aligned chunks of this `size`, such as 1MiB, reading the next chunk while one is sent; each part in flight holds two chunks (0 reads a part as it is sent)")
+	fs.BoolVar(&opts.hedge, "hedge", false, "send a part a second time when it takes -hedge-factor times as long as the median part, keeping the first to succeed; this doubles the traffic of slow parts")
+	fs.Float64Var(&opts.hedgeFactor, "hedge-factor", 3, "how many times the median part duration a part runs before -hedge sends it again")
+	fs.StringVar(&opts.order, "order", "sequential", "order in which the parts of a file are started: sequential, reverse or random; stdin is always read in order")
+	opts.multipartThreshold = uploader.DefaultMultipartThreshold
+	fs.Var(byteSizeFlag{&opts.multipartThreshold}, "multipart-threshold", "files smaller than this `size`, in bytes or such as 16MiB, are uploaded with a single PUT (negative always uses multipart)")
+	fs.StringVar(&opts.contentType, "content-type", "", "Content-Type of the object (detected from the file when not set)")
+	fs.Var(opts.contentTypeMap, "content-type-map", "Content-Type of the files by extension, such as .wasm=application/wasm,.br=application/x-brotli, taking over from the detected one (repeatable)")
+	fs.BoolVar(&opts.followSymlinks, "follow-symlinks", false, "upload the files and directories that the symlinks of a directory point to, skipping cycles; by default symlinks are skipped like most backup tools do")
+	fs.BoolVar(&opts.gzip, "gzip", false, "compress the file with gzip while uploading, with Content-Encoding gzip and .gz appended to the default key")
+	fs.StringVar(&opts.sse, "sse", "", "server-side encryption algorithm: AES256, aws:kms or aws:kms:dsse")
+	fs.StringVar(&opts.kmsKeyID, "kms-key-id", "", "ID, alias or ARN of the KMS key used with -sse aws:kms")
+	fs.Var(opts.kmsContext, "kms-encryption-context", "KMS encryption context of the object as key=value with -sse aws:kms (repeatable)")
+	fs.StringVar(&keyTemplate, "key-template", "", "template of the object key such as backups/{year}/{month}/{hostname}-{basename}, with {path}, {dir}, {basename}, {name}, {ext}, {date}, {year}, {month}, {day}, {time} and {hostname}")
+	fs.StringVar(&opts.prefix, "prefix", "", "key prefix of the files when -file is a directory or with -stdin-list")
+	fs.StringVar(&opts.manifest, "manifest", "", "file listing the files to upload instead of -file, one localpath<TAB>s3key per line (# starts a comment)")
+	fs.BoolVar(&opts.stdinList, "stdin-list", false, "upload the files whose paths are read from stdin, one per line such as the output of find, keyed by their path under -prefix or with -key-template")
+	fs.BoolVar(&opts.failFast, "fail-fast", false, "with a directory, -manifest or -stdin-list, stop starting files once one failed")
+	fs.IntVar(&opts.parallelFiles, "parallel-files", 1, "number of files of a directory, -manifest or -stdin-list uploaded at the same time, their parts share a single pool of uploads in flight")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "print the upload plan and exit without making any AWS call")
+	fs.Func("http-proxy", "URL of the HTTP proxy of the AWS requests, such as http://proxy:3128, instead of the one of HTTPS_PROXY", func(s string) error {
+		proxy, err := url.Parse(s)
+		if err != nil || proxy.Host == "" || (proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5") {
+			return errors.New("must be an http, https or socks5 URL")
+		}
+		opts.httpProxy = proxy
+		return nil
+	})
+	fs.DurationVar(&opts.httpTimeout, "http-timeout", 0, "maximum duration of each AWS request; an UploadPart sends a whole part, so it must allow a part at the bandwidth shared by the parts in flight (0 is unbounded)")
+	fs.DurationVar(&opts.timeout, "timeout", 0, "maximum duration of the whole upload, such as 30m, after which it is aborted (0 is unbounded)")
+	fs.StringVar(&opts.resume, "resume", "", "ID of an unfinished multipart upload to resume; -part-size must match the original run")
+	fs.BoolVar(&opts.verifyOnly, "verify-only", false, "don't upload, check that the object at -key matches -file by its size, ETag and checksum without downloading it; -part-size must match the upload of a multipart object")
+	fs.BoolVar(&opts.resumeVerify, "resume-verify", false, "with -resume, check the MD5 of the uploaded parts against the file and upload the changed ones again, which reads the uploaded share of the file once more")
+	fs.BoolVar(&opts.overwrite, "overwrite", false, "replace an object that already exists at the key instead of failing")
+	fs.BoolVar(&opts.hash, "hash", false, "log the SHA256 of each file before and after uploading it and store it in the sha256 metadata of the object, which reads the file once more")
+	fs.BoolVar(&opts.dedupe, "dedupe", false, "skip the upload when the object at the key has the same SHA256, stored in its metadata by earlier -dedupe runs")
+	fs.BoolVar(&opts.doctor, "doctor", false, "check the credentials, the bucket, its region, write access and the notification instead of uploading, -file isn't needed")
+	fs.StringVar(&opts.listParts, "list-parts", "", "print the number, size, ETag and date of the parts uploaded so far to the multipart upload `ID` of -key instead of uploading, -file isn't needed")
+	fs.StringVar(&opts.abort, "abort", "", "abort the multipart upload `ID` of -key, deleting its parts, instead of uploading, -file isn't needed")
+	fs.BoolVar(&opts.abortAll, "abort-all", false, "abort every unfinished multipart upload of the keys under -prefix, whatever its age, instead of uploading")
+	fs.BoolVar(&opts.presign, "presign", false, "print a presigned PUT URL of -key instead of uploading, -file isn't needed")
+	fs.DurationVar(&opts.presignExpiry, "presign-expiry", DefaultPresignExpiry, "validity of the URLs printed by -presign, up to 168h")
+	fs.IntVar(&opts.presignParts, "presign-parts", 0, "with -presign, start a multipart upload and print the URLs of this many parts instead")
+	fs.Func("part-range", "advanced recovery of a corrupt object: with -resume, upload again only the parts FIRST-LAST (or a single part N) and complete with the other parts, which must all be uploaded", func(s string) error {
+		r, err := parsePartRange(s)
+		opts.partRange = r
+		return err
+	})
+	fs.BoolVar(&opts.noAbortOnFailure, "no-abort-on-failure", false, "keep a failed multipart upload on S3 to inspect its parts or continue it with -resume, instead of aborting it")
+	fs.BoolVar(&opts.cleanup, "cleanup", false, "abort unfinished multipart uploads of the key before uploading")
+	fs.DurationVar(&opts.cleanupAge, "cleanup-age", DefaultCleanupAge, "minimum age of the unfinished uploads aborted by -cleanup")
+	fs.StringVar(&opts.storageClass, "storage-class", "", "storage class of the object, such as STANDARD_IA, INTELLIGENT_TIERING or GLACIER_IR")
+	fs.BoolVar(&opts.confirmCold, "confirm-cold", false, "upload to -storage-class GLACIER or DEEP_ARCHIVE without asking, required when not run from a terminal")
+	fs.StringVar(&opts.acl, "acl", "", "canned ACL of the object, such as private, public-read or bucket-owner-full-control (the bucket's default when not set)")
+	fs.StringVar(&opts.objectLockMode, "object-lock-mode", "", "Object Lock retention mode of the object: GOVERNANCE or COMPLIANCE, requires -retain-until")
+	fs.Func("retain-until", "RFC3339 date until which the object is retained by -object-lock-mode", func(s string) error {
+		t, err := time.Parse(time.RFC3339, s)
+		opts.retainUntil = t
+		return err
+	})
+	fs.StringVar(&opts.cacheControl, "cache-control", "", "Cache-Control header returned with the object, such as max-age=3600")
+	fs.StringVar(&opts.contentDisposition, "content-disposition", "", "Content-Disposition header returned with the object, such as attachment")
+	fs.Func("expires", "RFC3339 date of the HTTP Expires header returned with the object, for caches (it doesn't delete the object)", func(s string) error {
+		t, err := time.Parse(time.RFC3339, s)
+		opts.expires = t
+		return err
+	})
+	fs.BoolVar(&opts.legalHold, "legal-hold", false, "place an Object Lock legal hold on the object")
+	fs.BoolVar(&opts.crc32c, "crc32c", false, "compute the CRC32C of the whole object from the parts as they are read and print it with the result, checked against the one S3 returns for the whole object")
+	fs.StringVar(&opts.checksumAlgorithm, "checksum-algorithm", "", "additional checksum S3 verifies each part and the object with: CRC32, CRC32C, SHA1 or SHA256 (none when not set)")
+	fs.Var(opts.metadata, "metadata", "user metadata of the object as key=value (repeatable)")
+	fs.Var(opts.tags, "tag", "tag of the object as key=value (repeatable)")
+	fs.StringVar(&opts.notify, "notify", "sns", "how the result is notified: sns, webhook or none")
+	fs.StringVar(&opts.snsTopic, "sns-topic", "", "ARN of the SNS topic notified about the result with -notify sns (no notification when not set)")
+	fs.Var(opts.snsAttributes, "sns-attribute", "message attribute of the SNS notifications as name=value, such as severity=error, for subscription filter policies (repeatable)")
+	fs.StringVar(&opts.webhookURL, "webhook-url", "", "URL the result is POSTed to as JSON with -notify webhook, such as a Slack incoming webhook")
+	fs.StringVar(&opts.metricsAddr, "metrics-addr", "", "address such as :9102 serving Prometheus metrics of the uploads at /metrics while the tool runs")
+	fs.BoolVar(&opts.stats, "stats", false, "print the throughput of each part and of the whole upload to stderr once it completed")
+	fs.TextVar(&opts.logLevel, "log-level", slog.LevelInfo, "minimum level of the logs: debug, info, warn or error")
+	fs.StringVar(&opts.logFormat, "log-format", "text", "format of the logs: text or json")
+	fs.StringVar(&opts.output, "output", "text", "format of the result: text logs it, json prints a summary to stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: go-s3-uploader -bucket NAME -file PATH [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Uploads a file to S3 in parallel parts using a multipart upload.\n\n")
+		fmt.Fprintf(fs.Output(), "The credentials, or the role of -assume-role-arn, need s3:PutObject, s3:GetObject to verify\n")
+		fmt.Fprintf(fs.Output(), "the upload and s3:AbortMultipartUpload to clean up a failed one on the objects. -resume also\n")
+		fmt.Fprintf(fs.Output(), "needs s3:ListMultipartUploadParts, -cleanup s3:ListBucketMultipartUploads on the bucket,\n")
+		fmt.Fprintf(fs.Output(), "-sse aws:kms kms:GenerateDataKey and kms:Decrypt on the key and -sns-topic sns:Publish on\n")
+		fmt.Fprintf(fs.Output(), "the topic. Assuming a role needs sts:AssumeRole, allowed by the role's trust policy.\n")
+		fmt.Fprintf(fs.Output(), "Without s3:ListBucket on the bucket, S3 denies looking up a missing key: the check for an\n")
+		fmt.Fprintf(fs.Output(), "existing object is then left to the conditional write of the upload.\n\n")
+		fmt.Fprintf(fs.Output(), "-part-range is meant for support: with -resume it replaces the parts of an upload kept by\n")
+		fmt.Fprintf(fs.Output(), "-no-abort-on-failure, for instance one part found corrupt, without sending the other parts again.\n\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		// The flag package has already printed the error and the usage
+		return nil, errUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return nil, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if configPath != "" {
+		if err := loadConfig(fs, configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check the required flags and the ranges of the numeric ones
+	if opts.bucket == "" {
+		return nil, errors.New("missing required flag: -bucket")
+	}
+	// Maintenance of the multipart uploads left on S3, instead of uploading
+	maintenance := opts.listParts != "" || opts.abort != "" || opts.abortAll
+	if opts.file == "" && !opts.presign && !opts.doctor && opts.manifest == "" && !opts.stdinList && !maintenance {
+		return nil, errors.New("missing required flag: -file")
+	}
+	if opts.manifest != "" {
+		// Every entry names its own file and key
+		if opts.file != "" || opts.key != "" || opts.prefix != "" || keyTemplate != "" {
+			return nil, errors.New("-manifest cannot be combined with -file, -key, -prefix or -key-template")
+		}
+		if opts.resume != "" || opts.cleanup || opts.presign {
+			return nil, errors.New("-manifest cannot be combined with -resume, -cleanup or -presign")
+		}
+	}
+	if opts.stdinList {
+		// The paths read name the files, keyed under -prefix
+		if opts.file != "" || opts.key != "" || opts.manifest != "" {
+			return nil, errors.New("-stdin-list cannot be combined with -file, -key or -manifest")
+		}
+		if opts.resume != "" || opts.cleanup || opts.presign || opts.verifyOnly {
+			return nil, errors.New("-stdin-list cannot be combined with -resume, -cleanup, -presign or -verify-only")
+		}
+	}
+	if maintenance {
+		if (opts.listParts != "" && (opts.abort != "" || opts.abortAll)) || (opts.abort != "" && opts.abortAll) {
+			return nil, errors.New("only one of -list-parts, -abort and -abort-all can be set")
+		}
+		if opts.resume != "" || opts.manifest != "" || opts.stdinList || opts.presign || opts.doctor || opts.verifyOnly || opts.cleanup {
+			return nil, errors.New("-list-parts, -abort and -abort-all cannot be combined with -resume, -manifest, -stdin-list, -presign, -doctor, -verify-only or -cleanup")
+		}
+	}
+	if (opts.listParts != "" || opts.abort != "") && opts.file == "" && opts.key == "" {
+		return nil, errors.New("missing required flag: -list-parts and -abort need -key or -file")
+	}
+	// An empty prefix would abort the uploads of the whole bucket
+	if opts.abortAll && opts.prefix == "" {
+		return nil, errors.New("missing required flag: -abort-all needs the -prefix of the keys whose uploads are aborted")
+	}
+	if opts.presign && opts.file == "" && opts.key == "" {
+		return nil, errors.New("missing required flag: -presign needs -key or -file")
+	}
+	if opts.presignExpiry <= 0 || opts.presignExpiry > maxPresignExpiry {
+		return nil, fmt.Errorf("invalid -presign-expiry %s: must be positive and at most %s", opts.presignExpiry, maxPresignExpiry)
+	}
+	if opts.presignParts < 0 || opts.presignParts > uploader.MaxParts {
+		return nil, fmt.Errorf("invalid -presign-parts %d: must be between 0 and %d", opts.presignParts, uploader.MaxParts)
+	}
+	if opts.partSize < 0 {
+		return nil, fmt.Errorf("invalid -part-size %d: must be positive", opts.partSize)
+	}
+	if opts.maxBandwidth < 0 {
+		return nil, fmt.Errorf("invalid -max-bandwidth %d: must not be negative", opts.maxBandwidth)
+	}
+	if opts.maxRequestRate < 0 {
+		return nil, fmt.Errorf("invalid -max-request-rate %g: must not be negative", opts.maxRequestRate)
+	}
+	if !slices.Contains(uploader.PartOrders, uploader.PartOrder(opts.order)) {
+		return nil, fmt.Errorf("invalid -order %q: must be one of %v", opts.order, uploader.PartOrders)
+	}
+	if opts.hedgeFactor < 1 {
+		return nil, fmt.Errorf("invalid -hedge-factor %g: must be at least 1", opts.hedgeFactor)
+	}
+	if opts.readBuffer < 0 {
+		return nil, fmt.Errorf("invalid -read-buffer %d: must not be negative", opts.readBuffer)
+	}
+	if opts.maxBufferMemory < 0 {
+		return nil, fmt.Errorf("invalid -max-buffer-memory %d: must not be negative", opts.maxBufferMemory)
+	}
+	if opts.timeout < 0 {
+		return nil, fmt.Errorf("invalid -timeout %s: must not be negative", opts.timeout)
+	}
+	if opts.httpTimeout < 0 {
+		return nil, fmt.Errorf("invalid -http-timeout %s: must not be negative", opts.httpTimeout)
+	}
+	if opts.retries < 0 {
+		return nil, fmt.Errorf("invalid -retries %d: must not be negative", opts.retries)
+	}
+	if opts.concurrency < 1 {
+		return nil, fmt.Errorf("invalid -concurrency %d: must be at least 1", opts.concurrency)
+	}
+	if opts.parallelFiles < 1 {
+		return nil, fmt.Errorf("invalid -parallel-files %d: must be at least 1", opts.parallelFiles)
+	}
+	if opts.expectedBucketOwner != "" && !isAccountID(opts.expectedBucketOwner) {
+		return nil, fmt.Errorf("invalid -expected-bucket-owner %q: must be a 12-digit AWS account ID", opts.expectedBucketOwner)
+	}
+	if opts.sdkMaxRetries < 0 {
+		return nil, fmt.Errorf("invalid -sdk-max-retries %d: must not be negative", opts.sdkMaxRetries)
+	}
+
+	if opts.resumeVerify && opts.resume == "" {
+		return nil, errors.New("-resume-verify requires -resume")
+	}
+	// The part ETags of KMS encrypted objects aren't MD5s to check the file against
+	if opts.resumeVerify && (opts.sse == string(types.ServerSideEncryptionAwsKms) || opts.sse == string(types.ServerSideEncryptionAwsKmsDsse)) {
+		return nil, fmt.Errorf("-resume-verify cannot be combined with -sse %s, the part ETags of KMS encrypted objects aren't MD5s", opts.sse)
+	}
+	if opts.verifyOnly {
+		if opts.file == stdinFile || opts.manifest != "" {
+			return nil, errors.New("-verify-only needs a local -file")
+		}
+		if opts.resume != "" || opts.gzip || opts.cleanup || opts.dryRun || opts.presign || opts.doctor {
+			return nil, errors.New("-verify-only cannot be combined with -resume, -gzip, -cleanup, -dry-run, -presign or -doctor")
+		}
+	}
+	if opts.partRange != nil && opts.resume == "" {
+		return nil, errors.New("-part-range requires -resume")
+	}
+	if opts.resume != "" && opts.file == stdinFile {
+		return nil, errors.New("-resume cannot be used when reading from stdin")
+	}
+	if opts.logFormat != "text" && opts.logFormat != "json" {
+		return nil, fmt.Errorf("invalid -log-format %q: must be text or json", opts.logFormat)
+	}
+	if opts.output != "text" && opts.output != "json" {
+		return nil, fmt.Errorf("invalid -output %q: must be text or json", opts.output)
+	}
+	switch opts.notify {
+	case "sns", "none":
+	case "webhook":
+		if opts.webhookURL == "" {
+			return nil, errors.New("-notify webhook requires -webhook-url")
+		}
+	default:
+		return nil, fmt.Errorf("invalid -notify %q: must be sns, webhook or none", opts.notify)
+	}
+	if len(opts.snsAttributes) > 0 && (opts.notify != "sns" || opts.snsTopic == "") {
+		return nil, errors.New("-sns-attribute requires -notify sns and -sns-topic")
+	}
+	if err := validateSNSAttributes(opts.snsAttributes); err != nil {
+		return nil, err
+	}
+	if opts.accelerate && (opts.endpointURL != "" || opts.forcePathStyle) {
+		return nil, errors.New("-accelerate cannot be combined with -endpoint-url or -force-path-style")
+	}
+	if opts.dedupe && opts.file == stdinFile {
+		return nil, errors.New("-dedupe cannot be used when reading from stdin, the content must be hashed before uploading")
+	}
+	if opts.hash && opts.file == stdinFile {
+		return nil, errors.New("-hash cannot be used when reading from stdin, the content must be hashed before uploading")
+	}
+	if opts.gzip && opts.resume != "" {
+		return nil, errors.New("-gzip cannot be combined with -resume, the compressed parts don't line up with the file")
+	}
+	if opts.cleanup && opts.resume != "" {
+		return nil, errors.New("-cleanup cannot be combined with -resume, it could abort the resumed upload")
+	}
+	if opts.sse != "" && !slices.Contains(types.ServerSideEncryption("").Values(), types.ServerSideEncryption(opts.sse)) {
+		return nil, fmt.Errorf("invalid -sse %q: must be one of %v", opts.sse, types.ServerSideEncryption("").Values())
+	}
+	if opts.storageClass != "" && !slices.Contains(types.StorageClass("").Values(), types.StorageClass(opts.storageClass)) {
+		return nil, fmt.Errorf("invalid -storage-class %q: must be one of %v", opts.storageClass, types.StorageClass("").Values())
+	}
+	if opts.acl != "" && !slices.Contains(types.ObjectCannedACL("").Values(), types.ObjectCannedACL(opts.acl)) {
+		return nil, fmt.Errorf("invalid -acl %q: must be one of %v", opts.acl, types.ObjectCannedACL("").Values())
+	}
+	if opts.objectLockMode != "" && !slices.Contains(types.ObjectLockMode("").Values(), types.ObjectLockMode(opts.objectLockMode)) {
+		return nil, fmt.Errorf("invalid -object-lock-mode %q: must be one of %v", opts.objectLockMode, types.ObjectLockMode("").Values())
+	}
+	if (opts.objectLockMode != "") != !opts.retainUntil.IsZero() {
+		return nil, errors.New("-object-lock-mode and -retain-until must be set together")
+	}
+	if !opts.retainUntil.IsZero() && !opts.retainUntil.After(time.Now()) {
+		return nil, fmt.Errorf("invalid -retain-until %s: must be in the future", opts.retainUntil.Format(time.RFC3339))
+	}
+	if opts.checksumAlgorithm != "" && !slices.Contains(checksumAlgorithms, types.ChecksumAlgorithm(opts.checksumAlgorithm)) {
+		return nil, fmt.Errorf("invalid -checksum-algorithm %q: must be one of %v", opts.checksumAlgorithm, checksumAlgorithms)
+	}
+	if opts.kmsKeyID != "" && !strings.HasPrefix(opts.sse, "aws:kms") {
+		return nil, errors.New("-kms-key-id requires -sse aws:kms or aws:kms:dsse")
+	}
+	if len(opts.kmsContext) > 0 && !strings.HasPrefix(opts.sse, "aws:kms") {
+		return nil, errors.New("-kms-encryption-context requires -sse aws:kms or aws:kms:dsse")
+	}
+	// The context is sent as JSON, whose strings can't hold invalid UTF-8
+	for k, v := range opts.kmsContext {
+		if !utf8.ValidString(k) || !utf8.ValidString(v) {
+			return nil, fmt.Errorf("invalid -kms-encryption-context %q: not valid UTF-8, it can't be encoded as JSON", k)
+		}
+	}
+	if err := validateTags(opts.tags); err != nil {
+		return nil, err
+	}
+	if len(opts.contentTypeMap) > 0 && opts.contentType != "" {
+		return nil, errors.New("-content-type-map cannot be combined with -content-type, which sets the type of every file")
+	}
+
+	if keyTemplate != "" {
+		if opts.key != "" || opts.prefix != "" {
+			return nil, errors.New("-key-template cannot be combined with -key or -prefix")
+		}
+		if (opts.file == stdinFile || opts.file == "") && !opts.stdinList {
+			return nil, errors.New("-key-template needs a -file to name, set -key instead")
+		}
+		t, err := parseKeyTemplate(keyTemplate)
+		if err != nil {
+			return nil, err
+		}
+		opts.keyTemplate = t
+		// A directory and -stdin-list expand it for each file
+		if opts.file != "" {
+			if opts.key, err = expandKey(t, filepath.Base(opts.file), time.Now()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if opts.key == "" && opts.manifest == "" && !opts.stdinList {
+		if opts.file == stdinFile {
+			return nil, errors.New("missing required flag: -key must be set when reading from stdin")
+		}
+		opts.key = filepath.Base(opts.file)
+		if opts.gzip {
+			opts.key += gzipSuffix
+		}
+	}
+
+	return opts, nil
+}
+
+// validateTags checks the -tag flags against the limits of S3, which otherwise
+// rejects the upload only once it is sent
+func validateTags(tags keyValueFlag) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("invalid -tag: %d tags are set, S3 allows at most %d per object", len(tags), maxTags)
+	}
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		if n := utf8.RuneCountInString(k); n > maxTagKeyLength {
+			return fmt.Errorf("invalid -tag %q: the key is %d characters long, at most %d are allowed", k, n, maxTagKeyLength)
+		}
+		if n := utf8.RuneCountInString(tags[k]); n > maxTagValueLength {
+			return fmt.Errorf("invalid -tag %q: the value is %d characters long, at most %d are allowed", k, n, maxTagValueLength)
+		}
+	}
+	return nil
+}
+
+// Most message attributes of an SNS message
+const maxSNSAttributes = 10
+
+// snsAttributeName matches the names SNS accepts for message attributes
+var snsAttributeName = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// validateSNSAttributes checks the -sns-attribute flags against the rules of SNS,
+// which rejects the notification over one it doesn't accept
+func validateSNSAttributes(attributes keyValueFlag) error {
+	if len(attributes) > maxSNSAttributes {
+		return fmt.Errorf("invalid -sns-attribute: %d attributes are set, SNS allows at most %d per message", len(attributes), maxSNSAttributes)
+	}
+	for _, name := range slices.Sorted(maps.Keys(attributes)) {
+		lower := strings.ToLower(name)
+		if len(name) > 256 || !snsAttributeName.MatchString(name) || strings.HasPrefix(lower, "aws.") || strings.HasPrefix(lower, "amazon.") {
+			return fmt.Errorf("invalid -sns-attribute %q: the name must be up to 256 letters, digits, -, _ or single . inside it, not starting with AWS. or Amazon.", name)
+		}
+		if attributes[name] == "" {
+			return fmt.Errorf("invalid -sns-attribute %q: the value must not be empty", name)
+		}
+	}
+	return nil
+}
+
+// isAccountID reports whether s is an AWS account ID, made of 12 digits
+func isAccountID(s string) bool {
+	if len(s) != 12 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePartRange parses the part numbers FIRST-LAST, or N for a single part
+func parsePartRange(s string) (*uploader.PartRange, error) {
+	first, last, found := strings.Cut(s, "-")
+	if !found {
+		last = first
+	}
+	r := &uploader.PartRange{}
+	var err error
+	if r.First, err = strconv.ParseInt(first, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid part range %q: want FIRST-LAST", s)
+	}
+	if r.Last, err = strconv.ParseInt(last, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid part range %q: want FIRST-LAST", s)
+	}
+	if r.First < 1 || r.First > r.Last {
+		return nil, fmt.Errorf("invalid part range %q: the part numbers start at 1 and FIRST must not be above LAST", s)
+	}
+	return r, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestValidateTags(t *testing.T) {
+	tags := func(n int) keyValueFlag {
+		f := keyValueFlag{}
+		for i := range n {
+			f[fmt.Sprintf("key%d", i)] = "value"
+		}
+		return f
+	}
+	// é is two bytes, the lengths S3 checks are in characters
+	const r = "é"
+	tests := []struct {
+		name    string
+		tags    keyValueFlag
+		wantErr string
+	}{
+		{"10 tags", tags(10), ""},
+		{"11 tags", tags(11), "11 tags are set"},
+		{"128 character key", keyValueFlag{strings.Repeat(r, 128): "v"}, ""},
+		{"129 character key", keyValueFlag{strings.Repeat(r, 129): "v"}, "the key is 129 characters long"},
+		{"256 character value", keyValueFlag{"k": strings.Repeat(r, 256)}, ""},
+		{"257 character value", keyValueFlag{"k": strings.Repeat(r, 257)}, "the value is 257 characters long"},
+		{"empty value", keyValueFlag{"k": ""}, ""},
+	}
+	for _, tt := range tests {
+		err := validateTags(tt.tags)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateTags = %v, want no error", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateTags = %v, want an error containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestResumeVerifyWithKMS(t *testing.T) {
+	for _, sse := range []string{"aws:kms", "aws:kms:dsse"} {
+		_, err := parseFlags([]string{"-bucket", "b", "-file", "f", "-resume", "upload-1", "-resume-verify", "-sse", sse}, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "-resume-verify cannot be combined with -sse "+sse) {
+			t.Errorf("-sse %s: parseFlags error = %v, want the -resume-verify error", sse, err)
+		}
+	}
+	if _, err := parseFlags([]string{"-bucket", "b", "-file", "f", "-resume", "upload-1", "-resume-verify", "-sse", "AES256"}, io.Discard); err != nil {
+		t.Errorf("-sse AES256: parseFlags error = %v, want none", err)
+	}
+}
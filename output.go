@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// uploadSummary is the result of one upload as printed by -output json
+type uploadSummary struct {
+	Bucket     string `json:"bucket"`
+	Key        string `json:"key"`
+	ETag       string `json:"etag,omitempty"`
+	CRC32C     string `json:"crc32c,omitempty"`
+	SHA256     string `json:"sha256,omitempty"`
+	VersionID  string `json:"versionId,omitempty"`
+	Size       int64  `json:"size"`
+	Parts      int    `json:"parts"`
+	Retries    int    `json:"retries"`
+	DurationMs int64  `json:"durationMs"`
+	Success    bool   `json:"success"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// transfer describes what an upload sent, for its summary
+type transfer struct {
+	size    int64
+	retries int
+	// CRC32C of the whole object with -crc32c, and SHA256 of the file with -hash
+	crc32c string
+	sha256 string
+	// The content was already uploaded and -dedupe skipped it
+	skipped bool
+}
+
+// newSummary builds the summary of the upload t to key that started at start and
+// returned resp and err
+func newSummary(bucket, key string, resp *s3.CompleteMultipartUploadOutput, t transfer, start time.Time, err error) uploadSummary {
+	summary := uploadSummary{
+		Bucket:     bucket,
+		Key:        key,
+		Size:       t.size,
+		Retries:    t.retries,
+		Skipped:    t.skipped,
+		DurationMs: time.Since(start).Milliseconds(),
+		Success:    err == nil,
+	}
+	if err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+	summary.ETag = strings.Trim(aws.ToString(resp.ETag), `"`)
+	summary.CRC32C = t.crc32c
+	summary.SHA256 = t.sha256
+	summary.VersionID = aws.ToString(resp.VersionId)
+	summary.Parts = partCount(summary.ETag)
+	return summary
+}
+
+// partCount returns the number of parts of an object from its ETag: a multipart
+// ETag ends in "-" and the part count, any other object is a single part
+func partCount(etag string) int {
+	if i := strings.LastIndexByte(etag, '-'); i >= 0 {
+		if n, err := strconv.Atoi(etag[i+1:]); err == nil {
+			return n
+		}
+	}
+	return 1
+}
+
+// writeJSON prints v to w as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	// URLs are printed as they are, not with & escaped
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+// countingReader counts the bytes read through it, to report the size of a
+// stream whose length isn't known up front
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// printStats prints the throughput of each part and of the whole upload for -stats
+func printStats(w io.Writer, stats uploader.Stats) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Part\tBytes\tSeconds\tMB/s\tAttempts\t")
+	for _, part := range stats.Parts {
+		fmt.Fprintf(tw, "%d\t%d\t%.2f\t%.2f\t%d\t\n", part.PartNumber, part.Bytes, part.Duration.Seconds(), part.BytesPerSecond()/1e6, part.Attempts)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "Total: %d bytes in %.2fs, %.2f MB/s, %d retries\n", stats.Bytes, stats.Duration.Seconds(), stats.BytesPerSecond()/1e6, stats.Retries())
+}
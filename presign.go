@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Longest expiry of a URL presigned with SigV4
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// presignResult holds the URLs printed by -presign
+type presignResult struct {
+	Bucket    string       `json:"bucket"`
+	Key       string       `json:"key"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+	URL       string       `json:"url,omitempty"`
+	UploadID  string       `json:"uploadId,omitempty"`
+	Parts     []presignURL `json:"parts,omitempty"`
+}
+
+// presignURL is the presigned URL of one part of a multipart upload
+type presignURL struct {
+	PartNumber int32  `json:"partNumber"`
+	URL        string `json:"url"`
+}
+
+// runPresign prints a presigned PUT URL of the -key object instead of uploading.
+// With -presign-parts it starts a multipart upload and prints the URLs of its
+// parts, the holder of the URLs then completes or aborts the upload.
+func runPresign(ctx context.Context, w io.Writer, cfg aws.Config, opts *options) error {
+	client := newS3Client(cfg, opts)
+	presigner := s3.NewPresignClient(client, s3.WithPresignExpires(opts.presignExpiry))
+	result := presignResult{
+		Bucket:    opts.bucket,
+		Key:       opts.key,
+		ExpiresAt: time.Now().Add(opts.presignExpiry).UTC().Truncate(time.Second),
+	}
+
+	if opts.presignParts == 0 {
+		req, err := presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+			Bucket:              aws.String(opts.bucket),
+			Key:                 aws.String(opts.key),
+			RequestPayer:        requestPayer(opts),
+			ExpectedBucketOwner: nonEmpty(opts.expectedBucketOwner),
+		})
+		if err != nil {
+			return fmt.Errorf("cannot presign upload: %w", err)
+		}
+		result.URL = req.URL
+	} else {
+		created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:              aws.String(opts.bucket),
+			Key:                 aws.String(opts.key),
+			RequestPayer:        requestPayer(opts),
+			ExpectedBucketOwner: nonEmpty(opts.expectedBucketOwner),
+		})
+		if err != nil {
+			return fmt.Errorf("cannot create multipart upload: %w", err)
+		}
+		result.UploadID = aws.ToString(created.UploadId)
+		for partNum := int32(1); partNum <= int32(opts.presignParts); partNum++ {
+			req, err := presigner.PresignUploadPart(ctx, &s3.UploadPartInput{
+				Bucket:              created.Bucket,
+				Key:                 created.Key,
+				UploadId:            created.UploadId,
+				PartNumber:          aws.Int32(partNum),
+				RequestPayer:        requestPayer(opts),
+				ExpectedBucketOwner: nonEmpty(opts.expectedBucketOwner),
+			})
+			if err != nil {
+				// Nobody could upload to it without the URLs
+				if _, abortErr := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+					Bucket:              created.Bucket,
+					Key:                 created.Key,
+					UploadId:            created.UploadId,
+					RequestPayer:        requestPayer(opts),
+					ExpectedBucketOwner: nonEmpty(opts.expectedBucketOwner),
+				}); abortErr != nil {
+					slog.Error("cannot abort multipart upload", "upload_id", result.UploadID, "error", abortErr)
+				}
+				return fmt.Errorf("cannot presign part %d of upload %s: %w", partNum, result.UploadID, err)
+			}
+			result.Parts = append(result.Parts, presignURL{PartNumber: partNum, URL: req.URL})
+		}
+	}
+
+	if opts.output == "json" {
+		return writeJSON(w, result)
+	}
+	fmt.Fprintf(w, "Bucket: %s\n", result.Bucket)
+	fmt.Fprintf(w, "Key: %s\n", result.Key)
+	fmt.Fprintf(w, "Expires: %s\n", result.ExpiresAt.Format(time.RFC3339))
+	if result.URL != "" {
+		fmt.Fprintf(w, "PUT %s\n", result.URL)
+		return nil
+	}
+	fmt.Fprintf(w, "Upload ID: %s\n", result.UploadID)
+	for _, part := range result.Parts {
+		fmt.Fprintf(w, "Part %d: PUT %s\n", part.PartNumber, part.URL)
+	}
+	return nil
+}
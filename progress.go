@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// How far back the upload rate of the ETA is averaged, and how long the
+// upload must have run before the rate is trusted
+const (
+	rateWindow    = 10 * time.Second
+	minRateSpan   = 2 * time.Second
+	etaEstimating = "estimating…"
+)
+
+// Shortest time between two redraws of the progress bar, and its width
+const (
+	barInterval = 250 * time.Millisecond
+	barWidth    = 30
+)
+
+// progressPrinter reports the progress of an upload and its estimated time
+// remaining, as a bar redrawn in place on a terminal or else as log lines
+type progressPrinter struct {
+	key     string
+	bar     io.Writer
+	mu      sync.Mutex
+	samples []progressSample
+	drawn   time.Time
+}
+
+// progressSample is the number of bytes uploaded at a point in time
+type progressSample struct {
+	at   time.Time
+	done int64
+}
+
+// newProgressPrinter creates the printer of the upload to key. The bar is drawn on
+// bar, or the progress is logged when it is nil.
+func newProgressPrinter(key string, bar io.Writer) *progressPrinter {
+	return &progressPrinter{key: key, bar: bar, samples: []progressSample{{at: time.Now()}}}
+}
+
+// progressBar returns where the progress bar is drawn: stdout when it is a
+// terminal, unless it is taken by -output json or several files share it
+func progressBar(opts *options) io.Writer {
+	if opts.output == "json" || opts.parallelFiles > 1 || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil
+	}
+	return os.Stdout
+}
+
+// print reports the share of the upload done so far along with the ETA
+func (p *progressPrinter) print(bytesDone, bytesTotal int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rate, ok := p.rate(bytesDone)
+	if p.bar != nil {
+		p.draw(bytesDone, bytesTotal, rate, ok)
+		return
+	}
+	if bytesTotal <= 0 {
+		slog.Info("upload progress", "key", p.key, "bytes_done", bytesDone)
+		return
+	}
+	percent := fmt.Sprintf("%.1f%%", float64(bytesDone)*100/float64(bytesTotal))
+	slog.Info("upload progress", "key", p.key, "bytes_done", bytesDone, "bytes_total", bytesTotal, "percent", percent, "eta", eta(bytesDone, bytesTotal, rate, ok))
+}
+
+// draw redraws the progress bar, at most once per barInterval but always once done
+func (p *progressPrinter) draw(bytesDone, bytesTotal int64, rate float64, ok bool) {
+	done := bytesTotal > 0 && bytesDone >= bytesTotal
+	now := time.Now()
+	if !done && now.Sub(p.drawn) < barInterval {
+		return
+	}
+	p.drawn = now
+
+	speed := "-- MB/s"
+	if ok {
+		speed = fmt.Sprintf("%.2f MB/s", rate/1e6)
+	}
+	if bytesTotal <= 0 {
+		fmt.Fprintf(p.bar, "\r\033[K%s %.1f MB %s", p.key, float64(bytesDone)/1e6, speed)
+		return
+	}
+	filled := int(float64(barWidth) * float64(bytesDone) / float64(bytesTotal))
+	fmt.Fprintf(p.bar, "\r\033[K%s [%s%s] %5.1f%% %s ETA %s", p.key, strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled),
+		float64(bytesDone)*100/float64(bytesTotal), speed, eta(bytesDone, bytesTotal, rate, ok))
+	if done {
+		fmt.Fprintln(p.bar)
+	}
+}
+
+// rate records bytesDone and returns the upload rate in bytes per second over
+// the last rateWindow, not ok while there isn't enough to go by
+func (p *progressPrinter) rate(bytesDone int64) (rate float64, ok bool) {
+	now := time.Now()
+	p.samples = append(p.samples, progressSample{at: now, done: bytesDone})
+	// Keep a single sample older than the window, the base of the rate
+	for len(p.samples) > 2 && now.Sub(p.samples[1].at) > rateWindow {
+		p.samples = p.samples[1:]
+	}
+
+	first := p.samples[0]
+	span := now.Sub(first.at)
+	if span < minRateSpan || bytesDone <= first.done {
+		return 0, false
+	}
+	return float64(bytesDone-first.done) / span.Seconds(), true
+}
+
+// eta returns the time the remaining bytes take at rate, or etaEstimating when
+// the rate isn't known yet
+func eta(bytesDone, bytesTotal int64, rate float64, ok bool) string {
+	if !ok {
+		return etaEstimating
+	}
+	remaining := time.Duration(float64(bytesTotal-bytesDone) / rate * float64(time.Second))
+	return remaining.Round(time.Second).String()
+}
@@ -0,0 +1,73 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// signalClient is a multipart upload whose parts run until they are cancelled.
+// The first part sends SIGTERM to the process.
+type signalClient struct {
+	uploader.S3API
+	once      sync.Once
+	mu        sync.Mutex
+	aborts    int
+	completes int
+}
+
+func (c *signalClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return &s3.CreateMultipartUploadOutput{Bucket: params.Bucket, Key: params.Key, UploadId: aws.String("upload-1")}, nil
+}
+
+func (c *signalClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	c.once.Do(func() {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+			panic(err)
+		}
+	})
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *signalClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.aborts++
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (c *signalClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.completes++
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func TestSIGTERMAbortsUpload(t *testing.T) {
+	ctx, stop := signalContext()
+	defer stop()
+	client := &signalClient{}
+	u := &uploader.Uploader{Client: client, Bucket: "bucket", PartSize: uploader.MinPartSize}
+	_, err := u.UploadBytes(ctx, "key", make([]byte, 3*uploader.MinPartSize))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Upload error = %v, want context.Canceled", err)
+	}
+	if !canceled(ctx) {
+		t.Error("the run isn't reported as cancelled by the user")
+	}
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.aborts != 1 || client.completes != 0 {
+		t.Errorf("%d aborts and %d completes, want 1 and 0", client.aborts, client.completes)
+	}
+}
@@ -0,0 +1,129 @@
+package uploader
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// partBody returns a reader of part of its own, to be sent as a request body.
+// With ReadBufferSize, the part is read from its file in aligned chunks, see
+// alignedReader. Parts of a stream are already in memory and read as they are.
+func (u *Uploader) partBody(part *io.SectionReader) io.ReadSeeker {
+	r, off, n := part.Outer()
+	if _, inMemory := r.(*bytes.Reader); u.ReadBufferSize <= 0 || inMemory {
+		return io.NewSectionReader(part, 0, part.Size())
+	}
+	return newAlignedReader(r, off, n, u.ReadBufferSize)
+}
+
+// alignedReader reads a section of r in chunks of a fixed size starting at
+// multiples of it, so the reads of the file stay aligned whatever the part size
+// and however little the HTTP client asks for at once. The next chunk is read in
+// the background while the current one is sent, overlapping the disk and the
+// network, so a reader holds two chunks. It can be rewound like the SectionReader
+// it replaces, for the SDK to sign and retry the body.
+type alignedReader struct {
+	r     io.ReaderAt
+	start int64
+	size  int64
+	chunk int64
+	// Read position in the section
+	pos int64
+	// Chunk being read from, which holds r from bufOff
+	buf    []byte
+	bufOff int64
+	// Chunk being read in the background, nil when none is
+	ahead chan chunkRead
+	// Buffer of the next chunk read, nil until the first one is allocated
+	spare []byte
+}
+
+// chunkRead is a chunk read from off, or the error reading it
+type chunkRead struct {
+	off  int64
+	data []byte
+	err  error
+}
+
+func newAlignedReader(r io.ReaderAt, start, size, chunk int64) *alignedReader {
+	return &alignedReader{r: r, start: start, size: size, chunk: chunk}
+}
+
+func (a *alignedReader) Read(p []byte) (int, error) {
+	if a.pos >= a.size {
+		return 0, io.EOF
+	}
+	abs := a.start + a.pos
+	if abs < a.bufOff || abs >= a.bufOff+int64(len(a.buf)) {
+		if err := a.load(abs - abs%a.chunk); err != nil {
+			return 0, err
+		}
+		if abs >= a.bufOff+int64(len(a.buf)) {
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+	end := min(int64(len(a.buf)), a.start+a.size-a.bufOff)
+	n := copy(p, a.buf[abs-a.bufOff:end])
+	a.pos += int64(n)
+	return n, nil
+}
+
+// load makes the chunk at off the current one, taking it from the background read
+// when it is the one read ahead, and starts reading the chunk after it
+func (a *alignedReader) load(off int64) error {
+	var next chunkRead
+	if a.ahead != nil {
+		next = <-a.ahead
+		a.ahead = nil
+		if next.off != off {
+			// A seek made the chunk read ahead useless
+			a.spare, next = next.data[:cap(next.data)], chunkRead{}
+		}
+	}
+	if next.data == nil {
+		next = a.readChunk(off, a.spare)
+	}
+	if next.err != nil {
+		a.spare = next.data[:cap(next.data)]
+		return next.err
+	}
+	a.spare = a.buf
+	a.buf, a.bufOff = next.data, off
+	if nextOff := off + a.chunk; nextOff < a.start+a.size {
+		buf, ahead := a.spare, make(chan chunkRead, 1)
+		a.spare, a.ahead = nil, ahead
+		go func() { ahead <- a.readChunk(nextOff, buf) }()
+	}
+	return nil
+}
+
+// readChunk reads the chunk at off into buf, allocated when nil
+func (a *alignedReader) readChunk(off int64, buf []byte) chunkRead {
+	if buf == nil {
+		buf = make([]byte, a.chunk)
+	}
+	n, err := a.r.ReadAt(buf[:a.chunk], off)
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return chunkRead{off: off, data: buf[:n], err: err}
+}
+
+// Seek moves the read position within the section, keeping the chunks read
+func (a *alignedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += a.pos
+	case io.SeekEnd:
+		offset += a.size
+	default:
+		return 0, errors.New("alignedReader.Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("alignedReader.Seek: negative position")
+	}
+	a.pos = offset
+	return offset, nil
+}
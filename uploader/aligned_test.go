@@ -0,0 +1,117 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+// readInSteps reads r to the end with reads of at most step bytes
+func readInSteps(r io.Reader, step int) ([]byte, error) {
+	var out []byte
+	buf := make([]byte, step)
+	for {
+		n, err := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+}
+
+func TestAlignedReaderMatchesSectionReader(t *testing.T) {
+	data := testData(10_000)
+	src := bytes.NewReader(data)
+	tests := []struct {
+		start, size, chunk int64
+	}{
+		// Chunks that don't divide the part size, from an unaligned start
+		{0, 3000, 700},
+		{1234, 3000, 700},
+		{1234, 3000, 4096},
+		{999, 1, 64},
+		// The last part reaching the end of the data
+		{7000, 3000, 1024},
+		{0, 10_000, 3333},
+	}
+	for _, tt := range tests {
+		want, _ := io.ReadAll(io.NewSectionReader(src, tt.start, tt.size))
+		for _, step := range []int{1, 13, 512, 5000} {
+			a := newAlignedReader(src, tt.start, tt.size, tt.chunk)
+			// Read part of the section, then rewind like the SDK does to retry a body
+			if _, err := io.ReadFull(a, make([]byte, min(int(tt.size)/2+1, int(tt.size)))); err != nil {
+				t.Fatalf("start %d size %d chunk %d: first read: %v", tt.start, tt.size, tt.chunk, err)
+			}
+			if pos, err := a.Seek(0, io.SeekStart); err != nil || pos != 0 {
+				t.Fatalf("start %d size %d chunk %d: Seek(0) = %d, %v", tt.start, tt.size, tt.chunk, pos, err)
+			}
+			got, err := readInSteps(a, step)
+			if err != nil {
+				t.Fatalf("start %d size %d chunk %d step %d: %v", tt.start, tt.size, tt.chunk, step, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("start %d size %d chunk %d step %d: read %d bytes that differ from the %d of the section",
+					tt.start, tt.size, tt.chunk, step, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestAlignedReaderSeek(t *testing.T) {
+	data := testData(5000)
+	a := newAlignedReader(bytes.NewReader(data), 100, 4000, 768)
+	if pos, err := a.Seek(-10, io.SeekEnd); err != nil || pos != 3990 {
+		t.Fatalf("Seek(-10, SeekEnd) = %d, %v, want 3990", pos, err)
+	}
+	got, err := io.ReadAll(a)
+	if err != nil || !bytes.Equal(got, data[4090:4100]) {
+		t.Errorf("read %v, %v after seeking to the last 10 bytes", got, err)
+	}
+	if _, err := a.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Seek to a negative position succeeded")
+	}
+}
+
+func TestUploadWithReadBufferSize(t *testing.T) {
+	client := &mockS3{}
+	u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize, ReadBufferSize: 1 << 20}
+	data := testData(2*MinPartSize + 12345)
+	// Wrapped so that the parts are read like those of a file, not taken as in memory
+	file := struct{ io.ReaderAt }{bytes.NewReader(data)}
+	if _, err := u.Upload(context.Background(), "key", file, int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(client.object, data) {
+		t.Error("uploaded object differs from the data")
+	}
+}
+
+// BenchmarkUpload compares reading the parts of a file as they are sent with
+// reading them in aligned chunks. The mock keeps a copy of every part.
+func BenchmarkUpload(b *testing.B) {
+	data := testData(4 * MinPartSize)
+	file := struct{ io.ReaderAt }{bytes.NewReader(data)}
+	for _, bench := range []struct {
+		name           string
+		readBufferSize int64
+	}{
+		{"unbuffered", 0},
+		{"read-buffer-1MiB", 1 << 20},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			u := &Uploader{Bucket: "bucket", PartSize: MinPartSize, ReadBufferSize: bench.readBufferSize}
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for b.Loop() {
+				u.Client = &mockS3{}
+				if _, err := u.Upload(context.Background(), "key", file, int64(len(data))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
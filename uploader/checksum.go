@@ -0,0 +1,122 @@
+package uploader
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// partSums computes the MD5 of the whole section, and its base64 checksum with
+// alg when alg isn't empty, reading the section once. crc, when not nil, is fed
+// the section as well.
+func partSums(part *io.SectionReader, alg types.ChecksumAlgorithm, crc hash.Hash32) ([]byte, string, error) {
+	md5Hash := md5.New()
+	writers := []io.Writer{md5Hash}
+	var checksumHash hash.Hash
+	if alg != "" {
+		var err error
+		if checksumHash, err = newChecksumHash(alg); err != nil {
+			return nil, "", err
+		}
+		writers = append(writers, checksumHash)
+	}
+	if crc != nil {
+		writers = append(writers, crc)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), io.NewSectionReader(part, 0, part.Size())); err != nil {
+		return nil, "", fmt.Errorf("cannot read part: %w", err)
+	}
+	if checksumHash == nil {
+		return md5Hash.Sum(nil), "", nil
+	}
+	return md5Hash.Sum(nil), base64.StdEncoding.EncodeToString(checksumHash.Sum(nil)), nil
+}
+
+// newChecksumHash returns the hash computing checksums with alg
+func newChecksumHash(alg types.ChecksumAlgorithm) (hash.Hash, error) {
+	switch alg {
+	case types.ChecksumAlgorithmCrc32:
+		return crc32.NewIEEE(), nil
+	case types.ChecksumAlgorithmCrc32c:
+		return crc32.New(castagnoli), nil
+	case types.ChecksumAlgorithmSha1:
+		return sha1.New(), nil
+	case types.ChecksumAlgorithmSha256:
+		return sha256.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm %q", alg)
+}
+
+// setPartChecksum sets the checksum of a part computed with alg on its upload request
+func setPartChecksum(input *s3.UploadPartInput, alg types.ChecksumAlgorithm, sum string) {
+	input.ChecksumAlgorithm = alg
+	switch alg {
+	case types.ChecksumAlgorithmCrc32:
+		input.ChecksumCRC32 = aws.String(sum)
+	case types.ChecksumAlgorithmCrc32c:
+		input.ChecksumCRC32C = aws.String(sum)
+	case types.ChecksumAlgorithmSha1:
+		input.ChecksumSHA1 = aws.String(sum)
+	case types.ChecksumAlgorithmSha256:
+		input.ChecksumSHA256 = aws.String(sum)
+	}
+}
+
+// setCompletedChecksum sets the checksum of a part computed with alg in the
+// complete request, where S3 checks it against the one it stored for the part
+func setCompletedChecksum(part *types.CompletedPart, alg types.ChecksumAlgorithm, sum string) {
+	switch alg {
+	case types.ChecksumAlgorithmCrc32:
+		part.ChecksumCRC32 = aws.String(sum)
+	case types.ChecksumAlgorithmCrc32c:
+		part.ChecksumCRC32C = aws.String(sum)
+	case types.ChecksumAlgorithmSha1:
+		part.ChecksumSHA1 = aws.String(sum)
+	case types.ChecksumAlgorithmSha256:
+		part.ChecksumSHA256 = aws.String(sum)
+	}
+}
+
+// verifyETag checks that the ETag S3 returned for a part is the MD5 of the bytes sent
+func verifyETag(partNum int, etag *string, sum []byte) error {
+	got := strings.Trim(aws.ToString(etag), `"`)
+	if want := hex.EncodeToString(sum); !strings.EqualFold(got, want) {
+		return fmt.Errorf("part %d: ETag %q does not match local MD5 %q", partNum, got, want)
+	}
+	return nil
+}
+
+// etagMD5 decodes the MD5 of a part from its ETag, or returns nil when the ETag isn't an MD5
+func etagMD5(etag *string) []byte {
+	sum, err := hex.DecodeString(strings.Trim(aws.ToString(etag), `"`))
+	if err != nil || len(sum) != md5.Size {
+		return nil
+	}
+	return sum
+}
+
+// multipartETag computes the ETag S3 gives a multipart object: the hex MD5 of the
+// concatenated part MD5s followed by a dash and the number of parts. It returns ""
+// when the MD5 of a part is unknown.
+func multipartETag(parts []types.CompletedPart, partMD5s map[int32][]byte) string {
+	h := md5.New()
+	for _, part := range parts {
+		sum := partMD5s[aws.ToInt32(part.PartNumber)]
+		if sum == nil {
+			return ""
+		}
+		h.Write(sum)
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(h.Sum(nil)), len(parts))
+}
@@ -0,0 +1,59 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Abort aborts the multipart upload uploadID of key, deleting its parts
+func (u *Uploader) Abort(ctx context.Context, key, uploadID string) error {
+	err := u.abort(ctx, &s3.CreateMultipartUploadOutput{
+		Bucket:   aws.String(u.Bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot abort multipart upload %s: %w", uploadID, err)
+	}
+	return nil
+}
+
+// AbortStale aborts the unfinished multipart uploads of keys starting with prefix
+// that were initiated more than olderThan ago, every one of them when it is zero,
+// and returns how many were aborted. Failed runs leave such uploads behind, and
+// their parts keep accruing storage.
+func (u *Uploader) AbortStale(ctx context.Context, prefix string, olderThan time.Duration) (int, error) {
+	cutoff := u.now().Add(-olderThan)
+	aborted := 0
+
+	paginator := s3.NewListMultipartUploadsPaginator(u.Client, &s3.ListMultipartUploadsInput{
+		Bucket:              aws.String(u.Bucket),
+		Prefix:              aws.String(prefix),
+		RequestPayer:        u.RequestPayer,
+		ExpectedBucketOwner: u.bucketOwner(),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return aborted, fmt.Errorf("cannot list multipart uploads: %w", err)
+		}
+		for _, upload := range page.Uploads {
+			if upload.Initiated == nil || !upload.Initiated.Before(cutoff) {
+				continue
+			}
+			if err := u.abort(ctx, &s3.CreateMultipartUploadOutput{
+				Bucket:   aws.String(u.Bucket),
+				Key:      upload.Key,
+				UploadId: upload.UploadId,
+			}); err != nil {
+				return aborted, fmt.Errorf("cannot abort multipart upload %s: %w", aws.ToString(upload.UploadId), err)
+			}
+			aborted++
+		}
+	}
+	return aborted, nil
+}
@@ -0,0 +1,43 @@
+package uploader
+
+import (
+	"context"
+	"time"
+)
+
+// clock tells the time and waits for the uploads, so that tests can run the
+// retries and timings on a fake time instead of the real one
+type clock interface {
+	Now() time.Time
+	// After is time.After: the channel receives once d has passed
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the clock of the real time, used when none is set
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// clockOrReal returns the clock of u, or the real one when none is set
+func (u *Uploader) clockOrReal() clock {
+	if u.clock == nil {
+		return realClock{}
+	}
+	return u.clock
+}
+
+// now returns the current time of the clock of u
+func (u *Uploader) now() time.Time {
+	return u.clockOrReal().Now()
+}
+
+// sleep waits for d, returning the error of ctx as soon as it is done
+func (u *Uploader) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-u.clockOrReal().After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
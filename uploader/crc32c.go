@@ -0,0 +1,120 @@
+package uploader
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// castagnoli is the table of the CRC32C checksums
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// partCRC is the CRC32C of a part and its size, needed to append it to the CRC32C
+// of the parts before it
+type partCRC struct {
+	crc  uint32
+	size int64
+}
+
+// objectCRC32C combines the CRC32C of the parts 1 to numParts into the base64
+// CRC32C of the whole object. It returns false when a part has no CRC32C, such as
+// a resumed part uploaded without a CRC32C checksum.
+func objectCRC32C(parts map[int32]partCRC, numParts int) (string, bool) {
+	var crc uint32
+	for partNum := int32(1); partNum <= int32(numParts); partNum++ {
+		part, ok := parts[partNum]
+		if !ok {
+			return "", false
+		}
+		crc = crc32cCombine(crc, part.crc, part.size)
+	}
+	return encodeCRC32C(crc), true
+}
+
+// verifyCRC32C checks the CRC32C computed while uploading against the one S3
+// returned, when S3 returned the checksum of the whole object. A composite
+// checksum is one of the part checksums and can't be compared.
+func verifyCRC32C(sum string, got *string, checksumType types.ChecksumType) error {
+	if got == nil || checksumType == types.ChecksumTypeComposite || strings.Contains(*got, "-") {
+		return nil
+	}
+	if aws.ToString(got) != sum {
+		return fmt.Errorf("uploaded object has CRC32C %s but the local data gives %s", aws.ToString(got), sum)
+	}
+	return nil
+}
+
+// encodeCRC32C encodes a CRC32C the way S3 does, as the base64 of its big-endian bytes
+func encodeCRC32C(crc uint32) string {
+	return base64.StdEncoding.EncodeToString(binary.BigEndian.AppendUint32(nil, crc))
+}
+
+// decodeCRC32C decodes a CRC32C checksum returned by S3
+func decodeCRC32C(s *string) (uint32, bool) {
+	b, err := base64.StdEncoding.DecodeString(aws.ToString(s))
+	if err != nil || len(b) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(b), true
+}
+
+// crc32cCombine returns the CRC32C of two blocks from the CRC32C of each and the
+// length of the second, as zlib's crc32_combine: crc1 is shifted through len2
+// zero bytes by squaring the matrix of the one-bit shift.
+func crc32cCombine(crc1, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1 ^ crc2
+	}
+	var even, odd [32]uint32
+	// The operator shifting one zero bit
+	odd[0] = 0x82f63b78
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+	// Operators shifting two, then four zero bits
+	gf2MatrixSquare(&even, &odd)
+	gf2MatrixSquare(&odd, &even)
+	// Apply the operators of one zero byte, two, four... for the bits of len2
+	for {
+		gf2MatrixSquare(&even, &odd)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&even, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+		gf2MatrixSquare(&odd, &even)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(&odd, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat *[32]uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square, mat *[32]uint32) {
+	for n := range 32 {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
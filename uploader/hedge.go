@@ -0,0 +1,113 @@
+package uploader
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Completed parts needed before a median is trusted for hedging
+const minHedgeSamples = 3
+
+// partTimings collects the durations of the completed parts of an upload, to
+// tell when a part is a straggler. A nil *partTimings never hedges.
+type partTimings struct {
+	mu        sync.Mutex
+	durations []time.Duration
+	// added is closed and replaced by each completed part
+	added chan struct{}
+}
+
+func newPartTimings() *partTimings {
+	return &partTimings{added: make(chan struct{})}
+}
+
+func (t *partTimings) add(d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.durations = append(t.durations, d)
+	close(t.added)
+	t.added = make(chan struct{})
+}
+
+// hedgeDelay returns factor times the median duration of the completed parts, or
+// while too few parts have completed, a channel closed by the next one
+func (t *partTimings) hedgeDelay(factor float64) (time.Duration, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.durations) < minHedgeSamples {
+		return 0, t.added
+	}
+	sorted := slices.Clone(t.durations)
+	slices.Sort(sorted)
+	return time.Duration(float64(sorted[len(sorted)/2]) * factor), nil
+}
+
+// sendAttempt sends one attempt of a part. With timings, an attempt still running
+// after their hedge delay is raced against a second one for the same part number,
+// and the first to succeed is kept while the other is cancelled. Both send the
+// same bytes, so whichever S3 stores last has the ETag returned.
+func (u *Uploader) sendAttempt(ctx context.Context, input *s3.UploadPartInput, part *io.SectionReader, timings *partTimings) (*s3.UploadPartOutput, error) {
+	if timings == nil {
+		input.Body = throttle(ctx, u.partBody(part), u.Limiter)
+		return u.Client.UploadPart(ctx, input)
+	}
+
+	type outcome struct {
+		resp *s3.UploadPartOutput
+		err  error
+	}
+	// Each request reads the part through a reader of its own
+	outcomes := make(chan outcome, 2)
+	pending, hedged := 1, false
+	ctx, cancel := context.WithCancel(ctx)
+	// The part may be a buffer released once sent, so the request left is waited for
+	defer func() {
+		cancel()
+		for ; pending > 0; pending-- {
+			<-outcomes
+		}
+	}()
+	send := func() {
+		hedged := *input
+		hedged.Body = throttle(ctx, u.partBody(part), u.Limiter)
+		resp, err := u.Client.UploadPart(ctx, &hedged)
+		outcomes <- outcome{resp: resp, err: err}
+	}
+	start := u.now()
+	go send()
+	for {
+		// Until enough parts completed for a median, each one that does is a chance
+		// to arm the hedge, counting the time this part already ran
+		var hedge <-chan time.Time
+		var added <-chan struct{}
+		if !hedged {
+			var delay time.Duration
+			if delay, added = timings.hedgeDelay(u.HedgeFactor); added == nil {
+				hedge = u.clockOrReal().After(max(delay-u.now().Sub(start), 0))
+			}
+		}
+		select {
+		case <-added:
+		case <-hedge:
+			hedged = true
+			pending++
+			u.logger().Info("part is slower than the others, sending it a second time", "part_number", *input.PartNumber, "after", u.now().Sub(start).Round(time.Millisecond))
+			go send()
+		case o := <-outcomes:
+			pending--
+			// A failed request still has the other one to succeed
+			if o.err == nil || pending == 0 {
+				return o.resp, o.err
+			}
+			hedged = true
+		}
+	}
+}
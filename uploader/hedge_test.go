@@ -0,0 +1,57 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestHedgedPartCompletesOnce(t *testing.T) {
+	const slowPart = 5
+	var mu sync.Mutex
+	var loserErr error
+	client := &mockS3{
+		partFunc: func(ctx context.Context, partNum int32, attempt int) error {
+			if partNum != slowPart || attempt > 1 {
+				return nil
+			}
+			// The first request of the slow part only ends when the hedged one wins
+			<-ctx.Done()
+			mu.Lock()
+			loserErr = ctx.Err()
+			mu.Unlock()
+			return ctx.Err()
+		},
+	}
+	u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize, Concurrency: slowPart, HedgeFactor: 2, clock: newFakeClock()}
+	if _, err := u.UploadBytes(context.Background(), "key", testData(slowPart*MinPartSize)); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.attempts[slowPart]; got != 2 {
+		t.Errorf("slow part sent %d times, want 2", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !errors.Is(loserErr, context.Canceled) {
+		t.Errorf("losing request ended with %v, want it cancelled", loserErr)
+	}
+	// The mock panics on a complete with a request in flight, so the loser ended before
+	if len(client.completes) != 1 {
+		t.Fatalf("%d completes, want 1", len(client.completes))
+	}
+	seen := map[int32]int{}
+	for _, part := range client.completes[0].MultipartUpload.Parts {
+		seen[aws.ToInt32(part.PartNumber)]++
+	}
+	for partNum := int32(1); partNum <= slowPart; partNum++ {
+		if seen[partNum] != 1 {
+			t.Errorf("part %d completed %d times, want once", partNum, seen[partNum])
+		}
+	}
+	if len(client.aborts) != 0 {
+		t.Errorf("%d aborts, want 0", len(client.aborts))
+	}
+}
@@ -0,0 +1,65 @@
+// Package metrics exports the uploads of an uploader.Uploader as Prometheus
+// metrics. It is kept apart so that the uploader itself doesn't depend on
+// Prometheus.
+package metrics
+
+import (
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics counts the uploads it observes, to be set as Uploader.Observer
+type Metrics struct {
+	uploads  *prometheus.CounterVec
+	parts    prometheus.Counter
+	retries  prometheus.Counter
+	bytes    prometheus.Counter
+	duration prometheus.Histogram
+}
+
+// New creates the upload metrics and registers them with reg
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		uploads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "uploads_total",
+			Help: "Number of finished uploads, by result: success or failure.",
+		}, []string{"result"}),
+		parts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "upload_parts_total",
+			Help: "Number of parts sent by completed uploads.",
+		}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "upload_part_retries_total",
+			Help: "Number of retried part attempts of completed uploads.",
+		}),
+		bytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "upload_bytes_total",
+			Help: "Number of bytes sent by completed uploads.",
+		}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "upload_duration_seconds",
+			Help:    "Duration of the completed uploads.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 4, 10),
+		}),
+	}
+	for _, c := range []prometheus.Collector{m.uploads, m.parts, m.retries, m.bytes, m.duration} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// UploadCompleted records a completed upload
+func (m *Metrics) UploadCompleted(stats uploader.Stats) {
+	m.uploads.WithLabelValues("success").Inc()
+	m.parts.Add(float64(len(stats.Parts)))
+	m.retries.Add(float64(stats.Retries()))
+	m.bytes.Add(float64(stats.Bytes))
+	m.duration.Observe(stats.Duration.Seconds())
+}
+
+// UploadFailed records a failed upload
+func (m *Metrics) UploadFailed(error) {
+	m.uploads.WithLabelValues("failure").Inc()
+}
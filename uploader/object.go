@@ -0,0 +1,157 @@
+package uploader
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ObjectOption sets a property of an uploaded object. The same settings are
+// used whether the object is sent as a multipart upload or a single PutObject.
+type ObjectOption func(*s3.CreateMultipartUploadInput)
+
+// WithContentType sets the Content-Type of the object
+func WithContentType(contentType string) ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		input.ContentType = aws.String(contentType)
+	}
+}
+
+// WithContentEncoding sets the Content-Encoding of the object, such as gzip for
+// data compressed before the upload
+func WithContentEncoding(encoding string) ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		input.ContentEncoding = aws.String(encoding)
+	}
+}
+
+// WithCacheControl sets the Cache-Control header S3 returns with the object, such
+// as max-age=3600 for static assets
+func WithCacheControl(cacheControl string) ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		input.CacheControl = aws.String(cacheControl)
+	}
+}
+
+// WithContentDisposition sets the Content-Disposition header S3 returns with the
+// object, such as attachment; filename="report.pdf"
+func WithContentDisposition(disposition string) ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		input.ContentDisposition = aws.String(disposition)
+	}
+}
+
+// WithExpires sets the Expires header S3 returns with the object, which tells
+// HTTP caches when their copy is stale. It isn't a lifecycle rule: the object
+// is kept past that date.
+func WithExpires(expires time.Time) ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		input.Expires = aws.Time(expires)
+	}
+}
+
+// WithMetadata sets user metadata stored with the object as x-amz-meta-* headers
+func WithMetadata(metadata map[string]string) ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		if input.Metadata == nil {
+			input.Metadata = make(map[string]string, len(metadata))
+		}
+		for k, v := range metadata {
+			input.Metadata[k] = v
+		}
+	}
+}
+
+// WithTags sets the object tags, used by lifecycle rules and cost allocation
+func WithTags(tags map[string]string) ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		values := url.Values{}
+		for k, v := range tags {
+			values.Set(k, v)
+		}
+		input.Tagging = aws.String(values.Encode())
+	}
+}
+
+// WithStorageClass sets the storage class the object is stored in
+func WithStorageClass(class types.StorageClass) ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		input.StorageClass = class
+	}
+}
+
+// WithACL sets the canned ACL of the object, used by buckets that have ACLs enabled
+func WithACL(acl types.ObjectCannedACL) ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		input.ACL = acl
+	}
+}
+
+// WithRetention locks the object version in mode, GOVERNANCE or COMPLIANCE, until
+// retainUntil. The bucket must have Object Lock enabled.
+func WithRetention(mode types.ObjectLockMode, retainUntil time.Time) ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		input.ObjectLockMode = mode
+		input.ObjectLockRetainUntilDate = aws.Time(retainUntil)
+	}
+}
+
+// WithLegalHold places a legal hold on the object version, which protects it
+// from deletion until the hold is removed. The bucket must have Object Lock enabled.
+func WithLegalHold() ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		input.ObjectLockLegalHoldStatus = types.ObjectLockLegalHoldStatusOn
+	}
+}
+
+// WithServerSideEncryption requests encryption at rest with the given algorithm,
+// using the KMS key kmsKeyID for aws:kms when it isn't empty
+func WithServerSideEncryption(sse types.ServerSideEncryption, kmsKeyID string) ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		input.ServerSideEncryption = sse
+		if kmsKeyID != "" {
+			input.SSEKMSKeyId = aws.String(kmsKeyID)
+		}
+	}
+}
+
+// WithEncryptionContext sets the KMS encryption context of an aws:kms encrypted
+// object, which KMS key policies can require. S3 takes it as base64 JSON.
+func WithEncryptionContext(encryptionContext map[string]string) ObjectOption {
+	// A map of strings always encodes
+	data, _ := json.Marshal(encryptionContext)
+	return func(input *s3.CreateMultipartUploadInput) {
+		input.SSEKMSEncryptionContext = aws.String(base64.StdEncoding.EncodeToString(data))
+	}
+}
+
+// WithChecksumAlgorithm has S3 verify each part, and the whole object on
+// completion, with an additional checksum computed with alg: CRC32, CRC32C, SHA1
+// or SHA256
+func WithChecksumAlgorithm(alg types.ChecksumAlgorithm) ObjectOption {
+	return func(input *s3.CreateMultipartUploadInput) {
+		input.ChecksumAlgorithm = alg
+	}
+}
+
+// verifyEncryption checks that S3 applied the requested server-side encryption.
+// Only the algorithm is compared, as S3 reports KMS keys as full ARNs even when
+// they were requested by ID or alias.
+func verifyEncryption(input *s3.CreateMultipartUploadInput, got types.ServerSideEncryption) error {
+	if input.ServerSideEncryption != "" && input.ServerSideEncryption != got {
+		return fmt.Errorf("requested server-side encryption %q but S3 applied %q", input.ServerSideEncryption, got)
+	}
+	return nil
+}
+
+// etagIsMD5 reports whether the ETags of an object encrypted with sse are the MD5 of its
+// content, which isn't the case for KMS encryption
+func etagIsMD5(sse types.ServerSideEncryption) bool {
+	return sse != types.ServerSideEncryptionAwsKms && sse != types.ServerSideEncryptionAwsKmsDsse
+}
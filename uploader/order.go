@@ -0,0 +1,43 @@
+package uploader
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+)
+
+// PartOrder is the order in which the parts of a file are started. The parts
+// are sorted before the upload is completed, so it doesn't change the object.
+type PartOrder string
+
+const (
+	// PartOrderSequential starts the parts from the first one, the default
+	PartOrderSequential PartOrder = "sequential"
+	// PartOrderReverse starts the parts from the last one
+	PartOrderReverse PartOrder = "reverse"
+	// PartOrderRandom starts the parts in a random order
+	PartOrderRandom PartOrder = "random"
+)
+
+// PartOrders lists the accepted part orders
+var PartOrders = []PartOrder{PartOrderSequential, PartOrderReverse, PartOrderRandom}
+
+// partNumbers returns the part numbers 1 to numParts in the order o
+func (o PartOrder) partNumbers(numParts int64) ([]int64, error) {
+	partNums := make([]int64, numParts)
+	for i := range partNums {
+		partNums[i] = int64(i + 1)
+	}
+	switch o {
+	case "", PartOrderSequential:
+	case PartOrderReverse:
+		slices.Reverse(partNums)
+	case PartOrderRandom:
+		rand.Shuffle(len(partNums), func(i, j int) {
+			partNums[i], partNums[j] = partNums[j], partNums[i]
+		})
+	default:
+		return nil, fmt.Errorf("unknown part order %q", o)
+	}
+	return partNums, nil
+}
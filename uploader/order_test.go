@@ -0,0 +1,58 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestUploadCompletesInEveryPartOrder(t *testing.T) {
+	for _, order := range PartOrders {
+		t.Run(string(order), func(t *testing.T) {
+			client := &mockS3{}
+			// One part at a time, so the parts reach S3 in the order they are started
+			u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize, Concurrency: 1, PartOrder: order}
+			data := testData(5*MinPartSize + 10)
+			if _, err := u.UploadBytes(context.Background(), "key", data); err != nil {
+				t.Fatal(err)
+			}
+			var sent []int32
+			for _, input := range client.uploads {
+				sent = append(sent, aws.ToInt32(input.PartNumber))
+			}
+			switch order {
+			case PartOrderSequential:
+				if want := []int32{1, 2, 3, 4, 5, 6}; !slices.Equal(sent, want) {
+					t.Errorf("parts sent in the order %v, want %v", sent, want)
+				}
+			case PartOrderReverse:
+				if want := []int32{6, 5, 4, 3, 2, 1}; !slices.Equal(sent, want) {
+					t.Errorf("parts sent in the order %v, want %v", sent, want)
+				}
+			}
+			if sorted := slices.Sorted(slices.Values(sent)); !slices.Equal(sorted, []int32{1, 2, 3, 4, 5, 6}) {
+				t.Errorf("parts sent %v, want each of 1 to 6 once", sent)
+			}
+			// The upload is completed with the parts in ascending order whatever the order they were sent in
+			var completed []int32
+			for _, part := range client.completes[0].MultipartUpload.Parts {
+				completed = append(completed, aws.ToInt32(part.PartNumber))
+			}
+			if !slices.IsSorted(completed) || len(completed) != 6 {
+				t.Errorf("completed with parts %v, want 1 to 6 in order", completed)
+			}
+			if !bytes.Equal(client.object, data) {
+				t.Error("uploaded object differs from the data")
+			}
+		})
+	}
+}
+
+func TestUnknownPartOrder(t *testing.T) {
+	if _, err := PartOrder("shuffled").partNumbers(3); err == nil {
+		t.Error("partNumbers of an unknown order succeeded, want an error")
+	}
+}
@@ -0,0 +1,36 @@
+package uploader
+
+// Plan describes how an upload of a given size is split, without uploading anything
+type Plan struct {
+	// Size is the number of bytes uploaded
+	Size int64
+	// Multipart is false when the object is sent with a single PutObject
+	Multipart bool
+	// PartSize is the size of every part but the last one
+	PartSize int64
+	// Parts is the number of parts, 0 when the size isn't known
+	Parts int
+	// Concurrency is the number of parts uploaded at the same time
+	Concurrency int
+}
+
+// Plan returns how an upload of size bytes would be split into parts. A negative
+// size is unknown, as for UploadStream, whose parts are sent as they are read.
+func (u *Uploader) Plan(size int64) Plan {
+	if size < 0 {
+		partSize := u.partSize(size)
+		return Plan{Size: size, Multipart: true, PartSize: partSize, Concurrency: u.ConcurrencyFor(partSize)}
+	}
+	if size < u.multipartThreshold() {
+		return Plan{Size: size, PartSize: size, Parts: 1, Concurrency: 1}
+	}
+	partSize := u.partSize(size)
+	parts := int(partCount(size, partSize))
+	return Plan{
+		Size:        size,
+		Multipart:   true,
+		PartSize:    partSize,
+		Parts:       parts,
+		Concurrency: max(min(u.ConcurrencyFor(partSize), parts), 1),
+	}
+}
@@ -0,0 +1,42 @@
+package uploader
+
+// PartPool bounds the number of parts in flight across every upload using it, to
+// be set as Uploader.Pool when several files are uploaded at the same time. Each
+// upload still waits only for its own parts before completing, so a slow upload
+// doesn't hold back the others.
+type PartPool struct {
+	sem chan struct{}
+}
+
+// NewPartPool returns a pool letting size parts upload at the same time,
+// DefaultConcurrency when size isn't positive
+func NewPartPool(size int) *PartPool {
+	if size <= 0 {
+		size = DefaultConcurrency
+	}
+	return &PartPool{sem: make(chan struct{}, size)}
+}
+
+// slots returns the semaphore of the part uploads of one upload with parts of
+// partSize bytes: the one of the pool when set, or else one of its own
+func (u *Uploader) slots(partSize int64) chan struct{} {
+	if u.Pool != nil {
+		return u.Pool.sem
+	}
+	n := u.ConcurrencyFor(partSize)
+	if n < u.concurrency() {
+		u.logger().Info("concurrency lowered to fit the buffer memory", "concurrency", n, "part_size", partSize, "max_buffer_memory", u.MaxBufferMemory)
+	}
+	return make(chan struct{}, n)
+}
+
+// ConcurrencyFor returns the number of parts of partSize bytes uploaded at the
+// same time: Concurrency, lowered so that the parts in flight fit in
+// MaxBufferMemory, but never below one
+func (u *Uploader) ConcurrencyFor(partSize int64) int {
+	n := u.concurrency()
+	if u.MaxBufferMemory > 0 && partSize > 0 {
+		n = int(min(int64(n), max(u.MaxBufferMemory/partSize, 1)))
+	}
+	return n
+}
@@ -0,0 +1,81 @@
+package uploader
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConcurrencyFor(t *testing.T) {
+	tests := []struct {
+		concurrency     int
+		maxBufferMemory int64
+		partSize        int64
+		want            int
+	}{
+		// No memory cap keeps the concurrency
+		{0, 0, 100 * mib, DefaultConcurrency},
+		{4, 0, 100 * mib, 4},
+		// The parts in flight fit in the cap
+		{8, 64 * mib, 16 * mib, 4},
+		{8, 70 * mib, 16 * mib, 4},
+		{8, 64 * mib, 8 * mib, 8},
+		// The cap never raises the concurrency
+		{8, 1024 * mib, 8 * mib, 8},
+		// Nor lowers it below one part
+		{8, 10 * mib, 16 * mib, 1},
+		// An unknown part size leaves the concurrency alone
+		{8, 10 * mib, 0, 8},
+	}
+	for _, tt := range tests {
+		u := &Uploader{Concurrency: tt.concurrency, MaxBufferMemory: tt.maxBufferMemory}
+		if got := u.ConcurrencyFor(tt.partSize); got != tt.want {
+			t.Errorf("ConcurrencyFor(%d) with Concurrency %d and MaxBufferMemory %d = %d, want %d",
+				tt.partSize, tt.concurrency, tt.maxBufferMemory, got, tt.want)
+		}
+	}
+}
+
+func TestPoolCompletesFasterUploadFirst(t *testing.T) {
+	pool := NewPartPool(4)
+	started, release := make(chan struct{}), make(chan struct{})
+	slowClient := &mockS3{
+		partFunc: func(ctx context.Context, partNum int32, attempt int) error {
+			if partNum == 2 {
+				close(started)
+				<-release
+			}
+			return nil
+		},
+	}
+	slow := &Uploader{Client: slowClient, Bucket: "bucket", PartSize: MinPartSize, Pool: pool}
+	slowDone := make(chan error, 1)
+	go func() {
+		_, err := slow.UploadBytes(context.Background(), "slow", testData(2*MinPartSize))
+		slowDone <- err
+	}()
+	<-started
+
+	// The other upload completes while a part of the slow one is still in flight
+	fastClient := &mockS3{}
+	fast := &Uploader{Client: fastClient, Bucket: "bucket", PartSize: MinPartSize, Pool: pool}
+	if _, err := fast.UploadBytes(context.Background(), "fast", testData(3*MinPartSize)); err != nil {
+		t.Fatal(err)
+	}
+	if len(fastClient.completes) != 1 {
+		t.Errorf("fast upload completed %d times, want 1", len(fastClient.completes))
+	}
+	slowClient.mu.Lock()
+	slowCompletes := len(slowClient.completes)
+	slowClient.mu.Unlock()
+	if slowCompletes != 0 {
+		t.Errorf("slow upload completed before its last part was sent")
+	}
+
+	close(release)
+	if err := <-slowDone; err != nil {
+		t.Fatal(err)
+	}
+	if len(slowClient.completes) != 1 {
+		t.Errorf("slow upload completed %d times, want 1", len(slowClient.completes))
+	}
+}
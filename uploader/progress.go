@@ -0,0 +1,30 @@
+package uploader
+
+import "sync"
+
+// ProgressFunc receives the number of bytes uploaded so far and the total size
+// of the upload, which is -1 when the size isn't known up front
+type ProgressFunc func(bytesDone, bytesTotal int64)
+
+// progress aggregates the bytes of the completed parts of one upload
+type progress struct {
+	mu    sync.Mutex
+	fn    ProgressFunc
+	done  int64
+	total int64
+}
+
+func newProgress(fn ProgressFunc, total int64) *progress {
+	return &progress{fn: fn, total: total}
+}
+
+// add records n more uploaded bytes and reports the new total to the callback
+func (p *progress) add(n int64) {
+	if p.fn == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	p.fn(p.done, p.total)
+}
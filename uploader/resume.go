@@ -0,0 +1,139 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Resume continues the multipart upload uploadID of size bytes from r to key.
+// Parts already on S3 are skipped and only the missing ones are uploaded before
+// completing. The part size must be the one the upload was started with, so that
+// each part number covers the same bytes as before; listed parts whose size
+// doesn't match are uploaded again, as are the ones whose bytes changed when
+// VerifyResumedParts is set.
+func (u *Uploader) Resume(ctx context.Context, key, uploadID string, r io.ReaderAt, size int64, opts ...ObjectOption) (resp *s3.CompleteMultipartUploadOutput, err error) {
+	defer func() { u.reportFailure(err) }()
+	if err := u.checkPartSize(size); err != nil {
+		return nil, err
+	}
+	input := u.createInput(key, opts)
+
+	listed, err := u.listParts(ctx, input.Key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	verify := u.VerifyResumedParts && etagIsMD5(input.ServerSideEncryption)
+	if u.VerifyResumedParts && !verify {
+		u.logger().Warn("uploaded parts not verified, the part ETags of KMS encrypted objects aren't MD5s")
+	}
+
+	// Keep the parts that line up with the ones this run would upload
+	partSize := u.partSize(size)
+	numParts := partCount(size, partSize)
+	uploaded := make(map[int32]types.Part)
+	for _, part := range listed {
+		partNum := int64(aws.ToInt32(part.PartNumber))
+		if partNum < 1 || partNum > numParts {
+			continue
+		}
+		offset, expected := partRange(size, partSize, partNum)
+		if aws.ToInt64(part.Size) != expected {
+			continue
+		}
+		if verify {
+			// A part whose local bytes changed since it was sent is sent again
+			same, err := sameMD5(io.NewSectionReader(r, offset, expected), part.ETag)
+			if err != nil {
+				return nil, err
+			}
+			if !same {
+				u.logger().Warn("uploaded part differs from the file, uploading it again", "part_number", partNum)
+				continue
+			}
+		}
+		uploaded[int32(partNum)] = part
+	}
+	if r := u.ResumeParts; r != nil {
+		if err := r.only(uploaded, numParts); err != nil {
+			return nil, err
+		}
+	}
+	u.logger().Info("resuming multipart upload", "upload_id", uploadID, "uploaded_parts", len(uploaded), "total_parts", numParts)
+
+	// The upload already exists, so its settings are taken from the requested ones
+	createdResp := &s3.CreateMultipartUploadOutput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		UploadId:             aws.String(uploadID),
+		ServerSideEncryption: input.ServerSideEncryption,
+		ChecksumAlgorithm:    input.ChecksumAlgorithm,
+	}
+	parts, err := u.fileParts(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return u.uploadParts(ctx, createdResp, parts, size, uploaded)
+}
+
+// ListParts returns every part uploaded so far to the multipart upload uploadID
+// of key, in the order of their numbers, following the pages of ListParts
+func (u *Uploader) ListParts(ctx context.Context, key, uploadID string) ([]types.Part, error) {
+	return u.listParts(ctx, aws.String(key), uploadID)
+}
+
+// listParts returns every part uploaded so far to the multipart upload uploadID
+func (u *Uploader) listParts(ctx context.Context, key *string, uploadID string) ([]types.Part, error) {
+	var parts []types.Part
+	paginator := s3.NewListPartsPaginator(u.Client, &s3.ListPartsInput{
+		Bucket:              aws.String(u.Bucket),
+		Key:                 key,
+		UploadId:            aws.String(uploadID),
+		RequestPayer:        u.RequestPayer,
+		ExpectedBucketOwner: u.bucketOwner(),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list parts of upload %s: %w", uploadID, err)
+		}
+		parts = append(parts, page.Parts...)
+	}
+	return parts, nil
+}
+
+// sameMD5 reports whether the MD5 of part is the one of the part ETag
+func sameMD5(part *io.SectionReader, etag *string) (bool, error) {
+	sum, _, err := partSums(part, "", nil)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(sum, etagMD5(etag)), nil
+}
+
+// PartRange is the range of part numbers First to Last, both included
+type PartRange struct {
+	First, Last int64
+}
+
+// only removes the parts of the range from uploaded so that they're uploaded
+// again, after checking the range and that every other part is uploaded
+func (r *PartRange) only(uploaded map[int32]types.Part, numParts int64) error {
+	if r.First < 1 || r.First > r.Last || r.Last > numParts {
+		return fmt.Errorf("part range %d-%d isn't within the %d parts of the upload", r.First, r.Last, numParts)
+	}
+	for partNum := int64(1); partNum <= numParts; partNum++ {
+		if partNum >= r.First && partNum <= r.Last {
+			delete(uploaded, int32(partNum))
+		} else if _, ok := uploaded[int32(partNum)]; !ok {
+			return fmt.Errorf("part %d outside of the part range %d-%d isn't uploaded", partNum, r.First, r.Last)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// resumeData is a file of 5 parts of MinPartSize bytes, the last one shorter
+var resumeData = testData(4*MinPartSize + 1000)
+
+// listedPart returns the bytes of part partNum of resumeData
+func listedPart(partNum int64) []byte {
+	offset, length := partRange(int64(len(resumeData)), MinPartSize, partNum)
+	return resumeData[offset : offset+length]
+}
+
+// resumeMock returns a mock whose upload lists parts, by part number
+func resumeMock(parts map[int32][]byte) *mockS3 {
+	return &mockS3{parts: parts}
+}
+
+// sentParts returns the sorted numbers of the parts sent to client
+func sentParts(client *mockS3) []int32 {
+	var nums []int32
+	for _, input := range client.uploads {
+		nums = append(nums, aws.ToInt32(input.PartNumber))
+	}
+	slices.Sort(nums)
+	return nums
+}
+
+func TestResumeSendsMissingAndWrongSizeParts(t *testing.T) {
+	client := resumeMock(map[int32][]byte{
+		1: listedPart(1),
+		// Sent with another part size
+		2: listedPart(2)[:MinPartSize/2],
+		3: listedPart(3),
+		4: listedPart(4),
+	})
+	u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize}
+	if _, err := u.Resume(context.Background(), "key", "upload-1", bytes.NewReader(resumeData), int64(len(resumeData))); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sentParts(client), []int32{2, 5}; !slices.Equal(got, want) {
+		t.Errorf("parts sent %v, want %v", got, want)
+	}
+	if !bytes.Equal(client.object, resumeData) {
+		t.Error("resumed object differs from the data")
+	}
+}
+
+func TestResumeVerifySendsChangedParts(t *testing.T) {
+	changed := bytes.Clone(listedPart(3))
+	changed[100]++
+	for _, verify := range []bool{false, true} {
+		client := resumeMock(map[int32][]byte{
+			1: listedPart(1),
+			2: listedPart(2),
+			3: changed,
+			4: listedPart(4),
+			5: listedPart(5),
+		})
+		u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize, VerifyResumedParts: verify}
+		if _, err := u.Resume(context.Background(), "key", "upload-1", bytes.NewReader(resumeData), int64(len(resumeData))); err != nil {
+			t.Fatal(err)
+		}
+		// Only the check of the part bytes finds the part of the right size that changed
+		var want []int32
+		if verify {
+			want = []int32{3}
+		}
+		if got := sentParts(client); !slices.Equal(got, want) {
+			t.Errorf("VerifyResumedParts %v: parts sent %v, want %v", verify, got, want)
+		}
+	}
+}
+
+func TestResumePartRange(t *testing.T) {
+	allParts := func() map[int32][]byte {
+		parts := map[int32][]byte{}
+		for partNum := int64(1); partNum <= 5; partNum++ {
+			parts[int32(partNum)] = listedPart(partNum)
+		}
+		return parts
+	}
+	tests := []struct {
+		name     string
+		listed   map[int32][]byte
+		parts    PartRange
+		wantSent []int32
+		wantErr  string
+	}{
+		{"range of listed parts", allParts(), PartRange{2, 3}, []int32{2, 3}, ""},
+		{"last part", allParts(), PartRange{5, 5}, []int32{5}, ""},
+		{"part outside the range not listed", func() map[int32][]byte {
+			parts := allParts()
+			delete(parts, 5)
+			return parts
+		}(), PartRange{2, 3}, nil, "part 5 outside of the part range 2-3 isn't uploaded"},
+		{"range past the last part", allParts(), PartRange{4, 6}, nil, "part range 4-6 isn't within the 5 parts"},
+		{"empty range", allParts(), PartRange{3, 2}, nil, "part range 3-2 isn't within"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := resumeMock(tt.listed)
+			u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize, ResumeParts: &tt.parts}
+			_, err := u.Resume(context.Background(), "key", "upload-1", bytes.NewReader(resumeData), int64(len(resumeData)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Resume error = %v, want one containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got := sentParts(client); !slices.Equal(got, tt.wantSent) {
+				t.Errorf("parts sent %v, want %v", got, tt.wantSent)
+			}
+		})
+	}
+}
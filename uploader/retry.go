@@ -0,0 +1,117 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Bounds of the exponential backoff between retries of a failed request
+const (
+	BackoffBase = 500 * time.Millisecond
+	BackoffMax  = 30 * time.Second
+)
+
+// Backoff returns how long to wait before retry number attempt (starting at 1).
+// The delay doubles per attempt up to BackoffMax, and half of it is random jitter
+// so that parts failing together don't retry in lockstep.
+func Backoff(attempt int) time.Duration {
+	d := BackoffMax
+	if attempt < 1 {
+		attempt = 1
+	}
+	// Stop shifting once the cap is reached so the duration can't overflow
+	if shift := attempt - 1; shift < 32 && BackoffBase<<shift < BackoffMax {
+		d = BackoffBase << shift
+	}
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+// Longest Retry-After followed, so a bogus header can't stall the upload
+const maxRetryAfter = 5 * time.Minute
+
+// retryDelay returns how long to wait before retry number attempt of a request
+// that failed with err: the Retry-After of the response when S3 sent one, such
+// as with a 503 SlowDown, or else the backoff. An HTTP date is waited for from now.
+func retryDelay(err error, attempt int, now time.Time) time.Duration {
+	var respErr *smithyhttp.ResponseError
+	if !errors.As(err, &respErr) || respErr.Response == nil || respErr.Response.Response == nil {
+		return Backoff(attempt)
+	}
+	header := respErr.Response.Header.Get("Retry-After")
+	if header == "" {
+		return Backoff(attempt)
+	}
+	// The header is either a number of seconds or an HTTP date
+	var d time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		d = at.Sub(now)
+	} else {
+		return Backoff(attempt)
+	}
+	return min(max(d, 0), maxRetryAfter)
+}
+
+// retry calls fn until it succeeds, fails with an error that isn't retryable or
+// has been called u.Retries+1 times, waiting for retryDelay in between. op names
+// the request in the logs.
+func (u *Uploader) retry(ctx context.Context, op string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		u.logger().Debug("sending request", "request", op, "attempt", attempt)
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		u.logger().Warn("request attempt failed", "request", op, "attempt", attempt, "error", err)
+		if attempt > u.Retries || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		if err := u.sleep(ctx, retryDelay(err, attempt, u.now())); err != nil {
+			return err
+		}
+	}
+}
+
+// Error codes S3 returns for requests that can succeed when sent again
+var retryableCodes = map[string]bool{
+	"RequestTimeout":           true,
+	"RequestTimeoutException":  true,
+	"Throttling":               true,
+	"ThrottlingException":      true,
+	"SlowDown":                 true,
+	"RequestLimitExceeded":     true,
+	"TooManyRequestsException": true,
+	"InternalError":            true,
+	"ServiceUnavailable":       true,
+	// The body was corrupted on the way
+	"BadDigest": true,
+}
+
+// retryable reports whether a failed request is worth sending again. Throttling,
+// timeouts and server errors are, as are errors without a response from S3 such
+// as a reset connection. Other errors S3 answers with, like AccessDenied or
+// NoSuchBucket, fail the same way on every attempt.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (retryableCodes[apiErr.ErrorCode()] || apiErr.ErrorFault() == smithy.FaultServer) {
+		return true
+	}
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		status := respErr.HTTPStatusCode()
+		return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+	}
+	return true
+}
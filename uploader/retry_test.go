@@ -0,0 +1,204 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// fakeClock is a clock whose waits end at once, moving its time forward by the
+// duration waited. It records every wait.
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) recorded() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.waits...)
+}
+
+// checkBackoffs checks that each wait is the backoff of its retry, whose jitter
+// keeps it between half and all of the doubled delay
+func checkBackoffs(t *testing.T, waits []time.Duration) {
+	t.Helper()
+	for i, wait := range waits {
+		d := min(BackoffBase<<i, BackoffMax)
+		if wait < d/2 || wait > d {
+			t.Errorf("wait %d is %v, want a backoff between %v and %v", i+1, wait, d/2, d)
+		}
+	}
+}
+
+func TestRetryWaitsBackoffBetweenAttempts(t *testing.T) {
+	clock := newFakeClock()
+	u := &Uploader{Retries: 5, clock: clock}
+	calls := 0
+	err := u.retry(context.Background(), "Test", func() error {
+		calls++
+		if calls < 4 {
+			return apiError("SlowDown", http.StatusServiceUnavailable)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 4 {
+		t.Errorf("%d calls, want 4", calls)
+	}
+	waits := clock.recorded()
+	if len(waits) != 3 {
+		t.Fatalf("waited %v, want 3 backoffs", waits)
+	}
+	checkBackoffs(t, waits)
+}
+
+func TestRetryWaitsRetryAfter(t *testing.T) {
+	clock := newFakeClock()
+	u := &Uploader{Retries: 1, clock: clock}
+	calls := 0
+	err := u.retry(context.Background(), "Test", func() error {
+		calls++
+		if calls == 1 {
+			err := apiError("SlowDown", http.StatusServiceUnavailable)
+			err.(*smithyhttp.ResponseError).Response.Header.Set("Retry-After", "7")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waits := clock.recorded(); len(waits) != 1 || waits[0] != 7*time.Second {
+		t.Errorf("waited %v, want the 7s of Retry-After", waits)
+	}
+}
+
+func TestRetryDoesNotWaitForPermanentError(t *testing.T) {
+	clock := newFakeClock()
+	u := &Uploader{Retries: 5, clock: clock}
+	calls := 0
+	err := u.retry(context.Background(), "Test", func() error {
+		calls++
+		return apiError("AccessDenied", http.StatusForbidden)
+	})
+	if err == nil {
+		t.Fatal("retry succeeded, want the AccessDenied error")
+	}
+	if calls != 1 {
+		t.Errorf("%d calls, want 1", calls)
+	}
+	if waits := clock.recorded(); len(waits) != 0 {
+		t.Errorf("waited %v, want no wait", waits)
+	}
+}
+
+// sendTestPart sends data as part 1 of an upload with sendPart
+func sendTestPart(u *Uploader, data []byte) partUploadResult {
+	resp := &s3.CreateMultipartUploadOutput{Bucket: aws.String("bucket"), Key: aws.String("key"), UploadId: aws.String("upload-1")}
+	part := io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))
+	return u.sendPart(context.Background(), resp, part, 1, nil)
+}
+
+func TestSendPartWaitsBackoffBetweenAttempts(t *testing.T) {
+	client := &mockS3{
+		partFunc: func(ctx context.Context, partNum int32, attempt int) error {
+			if attempt < 3 {
+				return apiError("InternalError", http.StatusInternalServerError)
+			}
+			return nil
+		},
+	}
+	clock := newFakeClock()
+	u := &Uploader{Client: client, Retries: 3, clock: clock}
+	result := sendTestPart(u, testData(1000))
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	if result.attempts != 3 {
+		t.Errorf("part took %d attempts, want 3", result.attempts)
+	}
+	waits := clock.recorded()
+	if len(waits) != 2 {
+		t.Fatalf("waited %v, want 2 backoffs", waits)
+	}
+	checkBackoffs(t, waits)
+}
+
+func TestSendPartWaitsOnlyBetweenAttempts(t *testing.T) {
+	for _, retries := range []int{0, 1, 4} {
+		client := &mockS3{
+			partFunc: func(ctx context.Context, partNum int32, attempt int) error {
+				return apiError("InternalError", http.StatusInternalServerError)
+			},
+		}
+		clock := newFakeClock()
+		u := &Uploader{Client: client, Retries: retries, clock: clock}
+		if result := sendTestPart(u, testData(1000)); result.err == nil {
+			t.Fatalf("Retries %d: part succeeded, want it to fail", retries)
+		}
+		if got := len(client.uploads); got != retries+1 {
+			t.Errorf("Retries %d: %d attempts, want %d", retries, got, retries+1)
+		}
+		// No backoff is waited for after the last attempt
+		if waits := clock.recorded(); len(waits) != retries {
+			t.Errorf("Retries %d: waited %v, want %d backoffs", retries, waits, retries)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"SlowDown", apiError("SlowDown", http.StatusServiceUnavailable), true},
+		{"InternalError", apiError("InternalError", http.StatusInternalServerError), true},
+		{"too many requests", apiError("", http.StatusTooManyRequests), true},
+		{"AccessDenied", apiError("AccessDenied", http.StatusForbidden), false},
+		{"NoSuchBucket", apiError("NoSuchBucket", http.StatusNotFound), false},
+		{"wrapped AccessDenied", fmt.Errorf("part 1: %w", apiError("AccessDenied", http.StatusForbidden)), false},
+		{"no response", errors.New("connection reset by peer"), true},
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("part 1: %w", context.DeadlineExceeded), false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
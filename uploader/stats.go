@@ -0,0 +1,93 @@
+package uploader
+
+import (
+	"sort"
+	"time"
+)
+
+// StatsFunc receives the timings of an upload once it has completed
+type StatsFunc func(Stats)
+
+// Observer is told about the outcome of every upload, such as to export metrics
+// with the metrics package. It may be called from several uploads at once.
+type Observer interface {
+	// UploadCompleted receives the timings of a completed upload
+	UploadCompleted(Stats)
+	// UploadFailed receives the error of a failed or cancelled upload
+	UploadFailed(error)
+}
+
+// Stats holds the timings of a completed upload
+type Stats struct {
+	// Parts are the parts uploaded by this run, sorted by part number. Parts
+	// already on S3 when resuming aren't included.
+	Parts []PartStats
+	// Bytes is the number of bytes uploaded by this run
+	Bytes int64
+	// Duration is the time from the first part started to the upload completed
+	Duration time.Duration
+	// CRC32C is the base64 CRC32C of the whole object when ComputeCRC32C is set,
+	// empty when resumed parts were uploaded without a CRC32C checksum
+	CRC32C string
+}
+
+// PartStats holds the timing of one uploaded part
+type PartStats struct {
+	PartNumber int32
+	Bytes      int64
+	// Duration is the time taken by the successful attempt
+	Duration time.Duration
+	// Attempts is the number of times the part was sent, 1 when it needed no retry
+	Attempts int
+}
+
+// BytesPerSecond returns the throughput of the whole upload
+func (s Stats) BytesPerSecond() float64 {
+	return bytesPerSecond(s.Bytes, s.Duration)
+}
+
+// Retries returns the number of retried part attempts of the whole upload
+func (s Stats) Retries() int {
+	retries := 0
+	for _, part := range s.Parts {
+		retries += max(part.Attempts-1, 0)
+	}
+	return retries
+}
+
+// BytesPerSecond returns the throughput of the part
+func (p PartStats) BytesPerSecond() float64 {
+	return bytesPerSecond(p.Bytes, p.Duration)
+}
+
+func bytesPerSecond(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+// reportStats sorts the part timings and passes them to the StatsFunc and the
+// Observer, if any
+func (u *Uploader) reportStats(parts []PartStats, bytes int64, start time.Time, crc32c string) {
+	if u.StatsFunc == nil && u.Observer == nil {
+		return
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+	stats := Stats{Parts: parts, Bytes: bytes, Duration: u.now().Sub(start), CRC32C: crc32c}
+	if u.StatsFunc != nil {
+		u.StatsFunc(stats)
+	}
+	if u.Observer != nil {
+		u.Observer.UploadCompleted(stats)
+	}
+}
+
+// reportFailure passes the error of a failed upload to the Observer, if any
+func (u *Uploader) reportFailure(err error) {
+	if err != nil && u.Observer != nil {
+		u.Observer.UploadFailed(err)
+	}
+}
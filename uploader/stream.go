@@ -0,0 +1,107 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// UploadStream uploads everything read from r until EOF to key, for sources of
+// unknown size like stdin. Each part is buffered in memory before it is sent, and
+// the last short read becomes the final part. A stream shorter than both the part
+// size and the multipart threshold is sent with a single PutObject.
+func (u *Uploader) UploadStream(ctx context.Context, key string, r io.Reader, opts ...ObjectOption) (resp *s3.CompleteMultipartUploadOutput, err error) {
+	defer func() { u.reportFailure(err) }()
+	input := u.createInput(key, opts)
+	buffers := newPartBuffers(u.partSize(-1))
+
+	// Read the first part up front to find out whether a multipart upload is needed
+	first, releaseFirst, err := readPart(r, buffers)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err == io.EOF && first.Size() < u.multipartThreshold() {
+		defer releaseFirst()
+		return u.putObject(ctx, input, first, first.Size())
+	}
+
+	done := err == io.EOF
+	partNum := 0
+	next := func() (int, *io.SectionReader, func(), error) {
+		if first != nil {
+			part := first
+			first = nil
+			if part.Size() > 0 {
+				partNum++
+				return partNum, part, releaseFirst, nil
+			}
+			releaseFirst()
+		}
+		if done {
+			return 0, nil, nil, io.EOF
+		}
+		part, release, err := readPart(r, buffers)
+		if err == io.EOF {
+			// The short read is the final part, an empty one is dropped
+			done = true
+			if part.Size() == 0 {
+				release()
+				return 0, nil, nil, io.EOF
+			}
+			partNum++
+			return partNum, part, release, nil
+		}
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		partNum++
+		return partNum, part, release, nil
+	}
+	return u.multipartUpload(ctx, input, next, -1)
+}
+
+// readPart reads up to a part of bytes from r into a buffer of buffers, given
+// back by release. It returns io.EOF together with the data when the stream
+// ended before the part was full.
+func readPart(r io.Reader, buffers *partBuffers) (*io.SectionReader, func(), error) {
+	buf := buffers.get()
+	release := func() { buffers.put(buf) }
+	n, err := io.ReadFull(r, *buf)
+	// Only the bytes read for this part are visible, never those of a previous one
+	part := io.NewSectionReader(bytes.NewReader((*buf)[:n]), 0, int64(n))
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return part, release, io.EOF
+	}
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return part, release, nil
+}
+
+// partBuffers reuses the part buffers of a stream upload, so that reading each
+// part doesn't leave a buffer of a part size for the GC to collect
+type partBuffers struct {
+	pool sync.Pool
+}
+
+func newPartBuffers(partSize int64) *partBuffers {
+	b := &partBuffers{}
+	b.pool.New = func() any {
+		buf := make([]byte, partSize)
+		return &buf
+	}
+	return b
+}
+
+func (b *partBuffers) get() *[]byte {
+	return b.pool.Get().(*[]byte)
+}
+
+func (b *partBuffers) put(buf *[]byte) {
+	b.pool.Put(buf)
+}
@@ -0,0 +1,37 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestUploadStream(t *testing.T) {
+	for _, size := range []int{0, 100, 3*MinPartSize + 1} {
+		client := &mockS3{}
+		u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize}
+		data := testData(size)
+		if _, err := u.UploadStream(context.Background(), "key", bytes.NewReader(data)); err != nil {
+			t.Fatalf("UploadStream of %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(client.object, data) {
+			t.Errorf("UploadStream of %d bytes: uploaded %d bytes that differ", size, len(client.object))
+		}
+	}
+}
+
+// BenchmarkUploadStream reports the allocations of a stream upload, which reuses
+// its part buffers. The mock keeps a copy of each part and of the object, about
+// twice the stream per upload.
+func BenchmarkUploadStream(b *testing.B) {
+	data := testData(4 * MinPartSize)
+	u := &Uploader{Bucket: "bucket", PartSize: MinPartSize}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		u.Client = &mockS3{}
+		if _, err := u.UploadStream(context.Background(), "key", bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
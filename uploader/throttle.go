@@ -0,0 +1,66 @@
+package uploader
+
+import (
+	"context"
+	"io"
+	"math"
+
+	"golang.org/x/time/rate"
+)
+
+// NewBandwidthLimiter returns a limiter capping uploads at bytesPerSec, to be set
+// as Uploader.Limiter. The limit is shared by every part using the limiter.
+func NewBandwidthLimiter(bytesPerSec int64) *rate.Limiter {
+	burst := int(min(bytesPerSec, maxThrottledRead, math.MaxInt))
+	return rate.NewLimiter(rate.Limit(bytesPerSec), burst)
+}
+
+// NewRequestLimiter returns a limiter of requestsPerSec requests, to be set as
+// Uploader.RequestLimiter. Up to a second of requests can be sent at once.
+func NewRequestLimiter(requestsPerSec float64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(requestsPerSec), max(int(requestsPerSec), 1))
+}
+
+// waitRequest waits for the RequestLimiter to allow one more request
+func (u *Uploader) waitRequest(ctx context.Context) error {
+	if u.RequestLimiter == nil {
+		return nil
+	}
+	return u.RequestLimiter.Wait(ctx)
+}
+
+// Largest read waiting on the limiter at once, so a slow limit doesn't stall a part
+const maxThrottledRead = 64 * 1024
+
+// throttledReader reads a part no faster than the limiter allows
+type throttledReader struct {
+	ctx     context.Context
+	r       io.ReadSeeker
+	limiter *rate.Limiter
+}
+
+// throttle wraps body with the limiter, or returns it unchanged when there is none
+func throttle(ctx context.Context, body io.ReadSeeker, limiter *rate.Limiter) io.ReadSeeker {
+	if limiter == nil {
+		return body
+	}
+	return &throttledReader{ctx: ctx, r: body, limiter: limiter}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if burst := t.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.WaitN(t.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Seek lets the SDK rewind the body, for retries and payload signing
+func (t *throttledReader) Seek(offset int64, whence int) (int64, error) {
+	return t.r.Seek(offset, whence)
+}
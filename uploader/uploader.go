@@ -0,0 +1,794 @@
+// Package uploader uploads objects to AWS S3 in parallel parts using multipart uploads.
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/time/rate"
+)
+
+// Limits of S3 multipart uploads
+const (
+	MaxParts    = 10_000
+	MinPartSize = 5 * mib
+)
+
+const mib = 1024 * 1024
+
+// Default values used when the matching Uploader field is left at zero
+const (
+	DefaultPartSize    = 50_000_000
+	DefaultConcurrency = 8
+	// Objects smaller than this are sent with a single PutObject
+	DefaultMultipartThreshold = 5 * 1024 * 1024
+)
+
+// Uploader uploads objects to a single bucket using multipart uploads
+type Uploader struct {
+	// Client is the S3 client used for every request, usually an *s3.Client
+	Client S3API
+	// Bucket is the destination bucket of the uploads
+	Bucket string
+	// PartSize is the size of each part in bytes. When zero it is computed from the
+	// size of the upload so that it stays within MaxParts parts. Uploads of more
+	// than one part fail when it is below MinPartSize.
+	PartSize int64
+	// Retries is the number of times a failed part is retried
+	Retries int
+	// Concurrency is the maximum number of parts uploaded at the same time, DefaultConcurrency when zero
+	Concurrency int
+	// MaxBufferMemory, when set, caps the bytes of the parts in flight by lowering
+	// the concurrency of uploads with large parts. See ConcurrencyFor.
+	MaxBufferMemory int64
+	// MultipartThreshold is the size from which multipart uploads are used, smaller
+	// objects are sent with a single PutObject. DefaultMultipartThreshold when zero,
+	// a negative value always uses multipart uploads.
+	MultipartThreshold int64
+	// ProgressFunc, when set, is called each time a part has been uploaded
+	ProgressFunc ProgressFunc
+	// Logger receives the events of the uploads, nothing is logged when nil
+	Logger *slog.Logger
+	// StatsFunc, when set, receives the timings of each completed upload
+	StatsFunc StatsFunc
+	// PartOrder is the order in which the parts of a file are started,
+	// PartOrderSequential when empty. Streams are always read in order.
+	PartOrder PartOrder
+	// ComputeCRC32C has the uploads compute the CRC32C of the whole object from the
+	// bytes read for the parts, reported in Stats.CRC32C and checked against the
+	// one S3 returns for the whole object
+	ComputeCRC32C bool
+	// OnPartComplete and OnPartFailed, when set, are called for each part that was
+	// uploaded or failed for good, one call at a time for an upload. Parts stopped
+	// because the upload was cancelled or another part failed aren't reported.
+	OnPartComplete func(partNum int, etag string, bytes int64, attempts int)
+	OnPartFailed   func(partNum int, err error)
+	// Observer, when set, is told about every completed and failed upload
+	Observer Observer
+	// Limiter, when set, caps the upload bandwidth in bytes per second across all
+	// parts in flight. See NewBandwidthLimiter. Over plain HTTP endpoints the SDK
+	// reads each body twice to sign it, which halves the effective rate.
+	Limiter *rate.Limiter
+	// RequestLimiter, when set, caps the rate of the requests creating objects:
+	// CreateMultipartUpload, CompleteMultipartUpload and PutObject, one token each.
+	// Shared by the uploads of many files, it keeps bulk jobs of small files
+	// below the request rate S3 answers with 503 SlowDown. See NewRequestLimiter.
+	RequestLimiter *rate.Limiter
+	// HedgeFactor, when above zero, sends a part a second time once it has taken
+	// HedgeFactor times the median duration of the completed parts of its upload,
+	// keeping whichever request succeeds first. It doubles the traffic of the
+	// straggling parts, and is skipped for KMS encrypted objects, whose part ETags
+	// differ between two uploads of the same part.
+	HedgeFactor float64
+	// ReadBufferSize, when above zero, reads the parts of a file in chunks of this
+	// many bytes at offsets multiple of it, reading the next chunk while the
+	// current one is sent. Each part in flight then holds two chunks in memory.
+	// When zero, the HTTP client reads the part from the file as it sends it.
+	ReadBufferSize int64
+	// NoOverwrite makes the upload fail with 412 Precondition Failed when an object
+	// already exists at the key, by sending If-None-Match: * on the request that
+	// creates the object. Backends without conditional writes may ignore it.
+	NoOverwrite bool
+	// KeepFailedUploads leaves a failed or cancelled multipart upload on S3 instead
+	// of aborting it, so its parts can be inspected or the upload resumed. Its parts
+	// are billed until it is completed or aborted.
+	KeepFailedUploads bool
+	// Pool, when set, bounds the parts in flight across all the uploads sharing it
+	// and replaces Concurrency. See NewPartPool.
+	Pool *PartPool
+	// VerifyResumedParts has Resume check the MD5 of each listed part against the
+	// bytes of the file at its offset, sending the parts that differ again. This
+	// reads the uploaded share of the file once more before resuming, which takes
+	// about as long as reading the whole file for an upload that was nearly done.
+	VerifyResumedParts bool
+	// ResumeParts, when set, has Resume upload again only the parts of the range,
+	// even when they were uploaded, and complete with the other uploaded parts.
+	// It recovers an object from a few corrupt parts and fails when any other
+	// part is missing.
+	ResumeParts *PartRange
+	// RequestPayer set to requester has the uploads to a requester-pays bucket
+	// billed to the caller, S3 denies them otherwise
+	RequestPayer types.RequestPayer
+	// ExpectedBucketOwner, when set, is the ID of the AWS account the bucket must
+	// belong to. Every request fails with 403 Access Denied when it doesn't, such as
+	// when the bucket was deleted and created again by someone else.
+	ExpectedBucketOwner string
+
+	// clock is the time of the retries and timings, the real one when nil
+	clock clock
+}
+
+// Struct to store the result of a part upload
+type partUploadResult struct {
+	partNum       int
+	completedPart *types.CompletedPart
+	bytes         int64
+	md5           []byte
+	// CRC32C of the part, when ComputeCRC32C is set
+	crc32c uint32
+	// Time taken by the successful attempt and number of attempts made
+	duration time.Duration
+	attempts int
+	err      error
+}
+
+// failure returns the error of the result. A result without a part can't be
+// completed, so it counts as a failure too.
+func (r partUploadResult) failure() error {
+	if r.err == nil && r.completedPart == nil {
+		return errors.New("part upload reported no completed part")
+	}
+	return r.err
+}
+
+// partSource returns the next part of an upload and its number, or io.EOF once
+// all parts were returned. release, when not nil, gives back the buffer of the
+// part once it was sent or failed.
+type partSource func() (partNum int, part *io.SectionReader, release func(), err error)
+
+// Upload reads size bytes from r and uploads them to key as a multipart upload,
+// or as a single PutObject when size is below the multipart threshold.
+// On failure or cancellation the multipart upload is aborted on S3.
+func (u *Uploader) Upload(ctx context.Context, key string, r io.ReaderAt, size int64, opts ...ObjectOption) (resp *s3.CompleteMultipartUploadOutput, err error) {
+	defer func() { u.reportFailure(err) }()
+	input := u.createInput(key, opts)
+	if size < u.multipartThreshold() {
+		return u.putObject(ctx, input, io.NewSectionReader(r, 0, size), size)
+	}
+
+	parts, err := u.fileParts(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return u.multipartUpload(ctx, input, parts, size)
+}
+
+// UploadBytes uploads data to key like Upload, for content that is already in
+// memory such as a generated report
+func (u *Uploader) UploadBytes(ctx context.Context, key string, data []byte, opts ...ObjectOption) (*s3.CompleteMultipartUploadOutput, error) {
+	return u.Upload(ctx, key, bytes.NewReader(data), int64(len(data)), opts...)
+}
+
+// fileParts splits the size bytes of r into parts of the configured part size,
+// returned in the PartOrder. The split is deterministic, so part N always covers
+// the same bytes.
+func (u *Uploader) fileParts(r io.ReaderAt, size int64) (partSource, error) {
+	partSize := u.partSize(size)
+	partNums, err := u.PartOrder.partNumbers(partCount(size, partSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// Iterate over file parts, each reading only its own section of the file
+	return func() (int, *io.SectionReader, func(), error) {
+		if len(partNums) == 0 {
+			return 0, nil, nil, io.EOF
+		}
+		partNum := partNums[0]
+		partNums = partNums[1:]
+		offset, length := partRange(size, partSize, partNum)
+		return int(partNum), io.NewSectionReader(r, offset, length), nil, nil
+	}, nil
+}
+
+// partCount returns the number of parts of partSize bytes covering size bytes
+func partCount(size, partSize int64) int64 {
+	if size <= 0 {
+		return 0
+	}
+	return (size-1)/partSize + 1
+}
+
+// partRange returns the offset and length of part partNum (starting at 1) of an
+// upload of size bytes split into parts of partSize bytes. Every part is full
+// except the last one, which holds what remains and is never empty.
+func partRange(size, partSize, partNum int64) (offset, length int64) {
+	offset = (partNum - 1) * partSize
+	return offset, min(partSize, size-offset)
+}
+
+// multipartUpload uploads the parts returned by next in parallel as a single
+// multipart upload of total bytes, -1 when the total isn't known
+func (u *Uploader) multipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, next partSource, total int64) (*s3.CompleteMultipartUploadOutput, error) {
+	if err := u.checkPartSize(total); err != nil {
+		return nil, err
+	}
+	// Initiate a multipart upload. Nothing is uploaded yet, so a failed request is
+	// retried; one that timed out after S3 created the upload leaves it unused,
+	// for -cleanup or a lifecycle rule to abort.
+	var createdResp *s3.CreateMultipartUploadOutput
+	err := u.retry(ctx, "CreateMultipartUpload", func() error {
+		if err := u.waitRequest(ctx); err != nil {
+			return err
+		}
+		var err error
+		createdResp, err = u.Client.CreateMultipartUpload(ctx, input)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create multipart upload: %w", err)
+	}
+	if err := verifyEncryption(input, createdResp.ServerSideEncryption); err != nil {
+		if abortErr := u.abortFailed(ctx, createdResp); abortErr != nil {
+			return nil, fmt.Errorf("%w (and cannot abort multipart upload: %v)", err, abortErr)
+		}
+		return nil, err
+	}
+	// Not every S3-compatible backend echoes the checksum algorithm back
+	if createdResp.ChecksumAlgorithm == "" {
+		createdResp.ChecksumAlgorithm = input.ChecksumAlgorithm
+	}
+	return u.uploadParts(ctx, createdResp, next, total, nil)
+}
+
+// UploadError is returned when a multipart upload fails after it was created. It
+// carries the ID of the upload, needed to resume it or to abort it by hand when
+// the abort failed too.
+type UploadError struct {
+	UploadID string
+	Err      error
+}
+
+func (e *UploadError) Error() string { return e.Err.Error() }
+
+func (e *UploadError) Unwrap() error { return e.Err }
+
+// uploadParts uploads the parts returned by next to an existing multipart upload
+// and completes it. Parts listed in uploaded are already on S3 and are skipped.
+func (u *Uploader) uploadParts(ctx context.Context, createdResp *s3.CreateMultipartUploadOutput, next partSource, total int64, uploaded map[int32]types.Part) (*s3.CompleteMultipartUploadOutput, error) {
+	u.logger().Info("multipart upload in progress", "upload_id", aws.ToString(createdResp.UploadId), "bucket", aws.ToString(createdResp.Bucket), "key", aws.ToString(createdResp.Key))
+	resp, err := u.sendParts(ctx, createdResp, next, total, uploaded)
+	if err != nil {
+		return nil, &UploadError{UploadID: aws.ToString(createdResp.UploadId), Err: err}
+	}
+	return resp, nil
+}
+
+// sendParts does the work of uploadParts, whose errors it doesn't wrap
+func (u *Uploader) sendParts(ctx context.Context, createdResp *s3.CreateMultipartUploadOutput, next partSource, total int64, uploaded map[int32]types.Part) (*s3.CompleteMultipartUploadOutput, error) {
+
+	var completedParts []types.CompletedPart
+	progress := newProgress(u.ProgressFunc, total)
+	// Size and MD5s of the parts, checked against the completed object
+	var uploadedBytes int64
+	partMD5s := make(map[int32][]byte)
+	// CRC32C of the parts for the one of the object, when ComputeCRC32C is set
+	partCRCs := make(map[int32]partCRC)
+	for _, part := range uploaded {
+		completedParts = append(completedParts, types.CompletedPart{
+			ETag:           part.ETag,
+			PartNumber:     part.PartNumber,
+			ChecksumCRC32:  part.ChecksumCRC32,
+			ChecksumCRC32C: part.ChecksumCRC32C,
+			ChecksumSHA1:   part.ChecksumSHA1,
+			ChecksumSHA256: part.ChecksumSHA256,
+		})
+		progress.add(aws.ToInt64(part.Size))
+		uploadedBytes += aws.ToInt64(part.Size)
+		partMD5s[aws.ToInt32(part.PartNumber)] = etagMD5(part.ETag)
+		if crc, ok := decodeCRC32C(part.ChecksumCRC32C); ok {
+			partCRCs[aws.ToInt32(part.PartNumber)] = partCRC{crc: crc, size: aws.ToInt64(part.Size)}
+		}
+	}
+
+	// Timings of the parts uploaded by this run
+	start := u.now()
+	var partStats []PartStats
+	var runBytes int64
+
+	// Semaphore bounding the number of part uploads in flight
+	sem := u.slots(u.partSize(total))
+	// Wait group and channel collecting the part results of this upload. The
+	// channel holds a result per slot, so a finished part goroutine exits without
+	// waiting for the loop below. Parts free their buffers and slots before
+	// reporting, so this saves goroutines rather than part memory.
+	var wg sync.WaitGroup
+	ch := make(chan partUploadResult, cap(sem))
+	// The parts are cancelled on the first failed one, so that the upload is only
+	// aborted once no UploadPart is in flight anymore
+	partCtx, cancelParts := context.WithCancel(ctx)
+	defer cancelParts()
+	// Durations of the completed parts, to spot the straggling ones when hedging
+	var timings *partTimings
+	if u.HedgeFactor > 0 {
+		if etagIsMD5(createdResp.ServerSideEncryption) {
+			timings = newPartTimings()
+		} else {
+			u.logger().Warn("hedging disabled, the part ETags of KMS encrypted objects differ between two uploads of a part")
+		}
+	}
+
+	// Read parts and dispatch them while the results are collected below. A free
+	// slot is taken before reading a part, so at most one part per slot is in memory.
+	var readErr error
+	var numParts int
+	go func() {
+		defer close(ch)
+		defer wg.Wait()
+		for count := 0; ; count++ {
+			select {
+			case sem <- struct{}{}:
+			case <-partCtx.Done():
+				return
+			}
+			partNum, part, release, err := next()
+			if err != nil {
+				<-sem
+				if err != io.EOF {
+					readErr = err
+				}
+				numParts = count
+				return
+			}
+			if _, ok := uploaded[int32(partNum)]; ok {
+				if release != nil {
+					release()
+				}
+				<-sem
+				continue
+			}
+			wg.Add(1)
+			// Start a goroutine to upload a part to S3
+			go u.uploadPart(partCtx, createdResp, part, release, partNum, timings, &wg, sem, ch)
+			u.logger().Debug("part upload started", "part_number", partNum, "bytes", part.Size())
+		}
+	}()
+
+	// Process the results from the channel, stopping the other parts on the first
+	// failed one. The upload is aborted below, after all parts have stopped.
+	var partErr error
+	failedParts := 0
+	for result := range ch {
+		result.err = result.failure()
+		if result.err != nil {
+			// A cancelled upload is aborted once after all parts have stopped
+			if ctx.Err() != nil {
+				continue
+			}
+			// Parts stopped because of an earlier failure didn't fail themselves
+			if partErr != nil && errors.Is(result.err, context.Canceled) {
+				continue
+			}
+			failedParts++
+			if u.OnPartFailed != nil {
+				u.OnPartFailed(result.partNum, result.err)
+			}
+			if partErr == nil {
+				partErr = result.err
+				cancelParts()
+			}
+		} else {
+			partNum := aws.ToInt32(result.completedPart.PartNumber)
+			stats := PartStats{PartNumber: partNum, Bytes: result.bytes, Duration: result.duration, Attempts: result.attempts}
+			u.logger().Debug("part upload finished", "part_number", partNum, "bytes", result.bytes, "attempts", result.attempts,
+				"duration", result.duration, "mb_per_second", stats.BytesPerSecond()/1e6)
+			partStats = append(partStats, stats)
+			runBytes += result.bytes
+			completedParts = append(completedParts, *result.completedPart)
+			progress.add(result.bytes)
+			uploadedBytes += result.bytes
+			partMD5s[aws.ToInt32(result.completedPart.PartNumber)] = result.md5
+			partCRCs[partNum] = partCRC{crc: result.crc32c, size: result.bytes}
+			if u.OnPartComplete != nil {
+				u.OnPartComplete(int(partNum), aws.ToString(result.completedPart.ETag), result.bytes, result.attempts)
+			}
+		}
+	}
+
+	// Clean up the partial upload on S3 when the upload was cancelled
+	if ctx.Err() != nil {
+		// The upload context is already done, so the abort gets its own
+		if err := u.abortFailed(context.Background(), createdResp); err != nil {
+			return nil, fmt.Errorf("cannot abort cancelled multipart upload: %w", err)
+		}
+		return nil, ctx.Err()
+	}
+	// A source that fails to read is handled like a failed part
+	if partErr == nil && readErr != nil {
+		partErr = fmt.Errorf("cannot read part: %w", readErr)
+	}
+	if partErr != nil {
+		// All failures end up in a single error, reported once by the caller
+		if failedParts > 1 {
+			partErr = fmt.Errorf("%d parts failed, first error: %w", failedParts, partErr)
+		}
+		if abortErr := u.abortFailed(ctx, createdResp); abortErr != nil {
+			return nil, fmt.Errorf("%w (and cannot abort multipart upload: %v)", partErr, abortErr)
+		}
+		return nil, partErr
+	}
+
+	// Order the array based on the PartNumber as each part could be uploaded in a different order
+	sort.Slice(completedParts, func(i, j int) bool {
+		return *completedParts[i].PartNumber < *completedParts[j].PartNumber
+	})
+
+	if len(completedParts) == 0 {
+		if err := u.abortFailed(ctx, createdResp); err != nil {
+			return nil, fmt.Errorf("cannot abort empty multipart upload: %w", err)
+		}
+		return nil, errors.New("no parts were successfully uploaded")
+	}
+	if err := validateParts(completedParts, numParts); err != nil {
+		if abortErr := u.abortFailed(ctx, createdResp); abortErr != nil {
+			return nil, fmt.Errorf("%w (and cannot abort multipart upload: %v)", err, abortErr)
+		}
+		return nil, err
+	}
+
+	// Signal AWS S3 that the multipart upload is finished. Completing again with the
+	// same parts is safe, so a throttled or timed out request is retried.
+	var resp *s3.CompleteMultipartUploadOutput
+	err := u.retry(ctx, "CompleteMultipartUpload", func() error {
+		if err := u.waitRequest(ctx); err != nil {
+			return err
+		}
+		var err error
+		resp, err = u.Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:              createdResp.Bucket,
+			Key:                 createdResp.Key,
+			UploadId:            createdResp.UploadId,
+			IfNoneMatch:         u.ifNoneMatch(),
+			RequestPayer:        u.RequestPayer,
+			ExpectedBucketOwner: u.bucketOwner(),
+			MultipartUpload: &types.CompletedMultipartUpload{
+				Parts: completedParts,
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot complete multipart upload: %w", err)
+	}
+
+	// The multipart ETag can only be predicted when it is made of part MD5s
+	expectedETag := ""
+	if etagIsMD5(createdResp.ServerSideEncryption) {
+		expectedETag = multipartETag(completedParts, partMD5s)
+	}
+	if err := u.verifyObject(ctx, resp.Bucket, resp.Key, resp.VersionId, uploadedBytes, expectedETag); err != nil {
+		return nil, err
+	}
+	var crc32c string
+	if u.ComputeCRC32C {
+		var ok bool
+		if crc32c, ok = objectCRC32C(partCRCs, len(completedParts)); !ok {
+			u.logger().Warn("CRC32C of the object not computed, resumed parts were uploaded without a CRC32C checksum")
+		} else if err := verifyCRC32C(crc32c, resp.ChecksumCRC32C, resp.ChecksumType); err != nil {
+			return nil, err
+		}
+	}
+	u.reportStats(partStats, runBytes, start, crc32c)
+	return resp, nil
+}
+
+// createInput builds the settings of the object uploaded to key
+func (u *Uploader) createInput(key string, opts []ObjectOption) *s3.CreateMultipartUploadInput {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:              aws.String(u.Bucket),
+		Key:                 aws.String(key),
+		RequestPayer:        u.RequestPayer,
+		ExpectedBucketOwner: u.bucketOwner(),
+	}
+	for _, opt := range opts {
+		opt(input)
+	}
+	return input
+}
+
+// ifNoneMatch returns the If-None-Match header of the request creating the object
+func (u *Uploader) ifNoneMatch() *string {
+	if u.NoOverwrite {
+		return aws.String("*")
+	}
+	return nil
+}
+
+// bucketOwner returns the expected bucket owner of the requests, nil when not set
+func (u *Uploader) bucketOwner() *string {
+	if u.ExpectedBucketOwner == "" {
+		return nil
+	}
+	return aws.String(u.ExpectedBucketOwner)
+}
+
+// putObject uploads a small object in a single request, using the same object
+// settings as a multipart upload. The result is reported like a completed
+// multipart upload so callers see no difference.
+func (u *Uploader) putObject(ctx context.Context, input *s3.CreateMultipartUploadInput, body *io.SectionReader, total int64) (*s3.CompleteMultipartUploadOutput, error) {
+	start := u.now()
+	var crc32c string
+	if u.ComputeCRC32C {
+		crc := crc32.New(castagnoli)
+		if _, err := io.Copy(crc, io.NewSectionReader(body, 0, body.Size())); err != nil {
+			return nil, fmt.Errorf("cannot read object: %w", err)
+		}
+		crc32c = encodeCRC32C(crc.Sum32())
+	}
+	// Sending the object again is safe, so a throttled or failed request is retried
+	// with a body of its own, read from the first byte
+	var resp *s3.PutObjectOutput
+	attempts := 0
+	err := u.retry(ctx, "PutObject", func() error {
+		attempts++
+		if err := u.waitRequest(ctx); err != nil {
+			return err
+		}
+		var err error
+		resp, err = u.Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:                  input.Bucket,
+			Key:                     input.Key,
+			Body:                    throttle(ctx, u.partBody(body), u.Limiter),
+			ContentLength:           aws.Int64(body.Size()),
+			Expires:                 input.Expires,
+			ContentType:             input.ContentType,
+			ContentEncoding:         input.ContentEncoding,
+			CacheControl:            input.CacheControl,
+			ContentDisposition:      input.ContentDisposition,
+			ServerSideEncryption:    input.ServerSideEncryption,
+			SSEKMSKeyId:             input.SSEKMSKeyId,
+			SSEKMSEncryptionContext: input.SSEKMSEncryptionContext,
+			Metadata:                input.Metadata,
+			Tagging:                 input.Tagging,
+			StorageClass:            input.StorageClass,
+			ACL:                     input.ACL,
+			ChecksumAlgorithm:       input.ChecksumAlgorithm,
+			IfNoneMatch:             u.ifNoneMatch(),
+			RequestPayer:            input.RequestPayer,
+			ExpectedBucketOwner:     u.bucketOwner(),
+
+			// Object Lock settings
+			ObjectLockMode:            input.ObjectLockMode,
+			ObjectLockRetainUntilDate: input.ObjectLockRetainUntilDate,
+			ObjectLockLegalHoldStatus: input.ObjectLockLegalHoldStatus,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot put object: %w", err)
+	}
+	elapsed := u.now().Sub(start)
+	if err := verifyEncryption(input, resp.ServerSideEncryption); err != nil {
+		return nil, err
+	}
+	if err := u.verifyObject(ctx, input.Bucket, input.Key, resp.VersionId, body.Size(), ""); err != nil {
+		return nil, err
+	}
+	if crc32c != "" {
+		if err := verifyCRC32C(crc32c, resp.ChecksumCRC32C, resp.ChecksumType); err != nil {
+			return nil, err
+		}
+	}
+	newProgress(u.ProgressFunc, total).add(body.Size())
+	u.reportStats([]PartStats{{PartNumber: 1, Bytes: body.Size(), Duration: elapsed, Attempts: attempts}}, body.Size(), start, crc32c)
+	return &s3.CompleteMultipartUploadOutput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		ETag:                 resp.ETag,
+		VersionId:            resp.VersionId,
+		Expiration:           resp.Expiration,
+		ServerSideEncryption: resp.ServerSideEncryption,
+		SSEKMSKeyId:          resp.SSEKMSKeyId,
+	}, nil
+}
+
+// Function to upload a part to AWS S3, running in a slot already taken from sem
+func (u *Uploader) uploadPart(ctx context.Context, resp *s3.CreateMultipartUploadOutput, part *io.SectionReader, release func(), partNum int, timings *partTimings, wg *sync.WaitGroup, sem chan struct{}, ch chan<- partUploadResult) {
+	defer wg.Done()
+	result := u.sendPart(ctx, resp, part, partNum, timings)
+	result.partNum = partNum
+	if release != nil {
+		release()
+	}
+	// Free the slot before handing over the result, so that a pool shared with
+	// other uploads isn't held while this one collects its results or completes
+	<-sem
+	ch <- result
+}
+
+// sendPart uploads one part, retrying failed attempts, and returns its result
+func (u *Uploader) sendPart(ctx context.Context, resp *s3.CreateMultipartUploadOutput, part *io.SectionReader, partNum int, timings *partTimings) (result partUploadResult) {
+	// A panic fails the part instead of the program, so the upload is still aborted
+	defer func() {
+		if r := recover(); r != nil {
+			u.logger().Error("part upload panicked", "part_number", partNum, "panic", r, "stack", string(debug.Stack()))
+			result = partUploadResult{err: fmt.Errorf("part %d: panic: %v", partNum, r)}
+		}
+	}()
+	// Compute the MD5 of the part once, S3 checks it on receipt and it is compared with the returned ETag.
+	// The additional checksum, when requested, is checked by S3 as well.
+	var crc hash.Hash32
+	if u.ComputeCRC32C {
+		crc = crc32.New(castagnoli)
+	}
+	sum, checksum, err := partSums(part, resp.ChecksumAlgorithm, crc)
+	if err != nil {
+		return partUploadResult{err: err}
+	}
+	// Attempt 1 is the first send, followed by up to u.Retries retries. The backoff
+	// is only waited for before a retry, never after the last attempt.
+	for attempt := 1; ; attempt++ {
+		u.logger().Debug("uploading part", "part_number", partNum, "bytes", part.Size(), "attempt", attempt)
+		// Rewind the section so a retry sends the part from its first byte
+		if _, err := part.Seek(0, io.SeekStart); err != nil {
+			return partUploadResult{err: err}
+		}
+		input := &s3.UploadPartInput{
+			Bucket:              resp.Bucket,
+			Key:                 resp.Key,
+			PartNumber:          aws.Int32(int32(partNum)),
+			UploadId:            resp.UploadId,
+			ContentLength:       aws.Int64(part.Size()),
+			ContentMD5:          aws.String(base64.StdEncoding.EncodeToString(sum)),
+			RequestPayer:        u.RequestPayer,
+			ExpectedBucketOwner: u.bucketOwner(),
+		}
+		if checksum != "" {
+			setPartChecksum(input, resp.ChecksumAlgorithm, checksum)
+		}
+		attemptStart := u.now()
+		uploadRes, err := u.sendAttempt(ctx, input, part, timings)
+		// A part whose ETag doesn't match was corrupted on the way and is retried
+		if err == nil && etagIsMD5(resp.ServerSideEncryption) {
+			err = verifyETag(partNum, uploadRes.ETag, sum)
+		}
+		if err == nil {
+			completedPart := &types.CompletedPart{
+				ETag:       uploadRes.ETag,
+				PartNumber: aws.Int32(int32(partNum)),
+			}
+			if checksum != "" {
+				setCompletedChecksum(completedPart, resp.ChecksumAlgorithm, checksum)
+			}
+			result = partUploadResult{
+				completedPart: completedPart,
+				bytes:         part.Size(),
+				md5:           sum,
+				duration:      u.now().Sub(attemptStart),
+				attempts:      attempt,
+			}
+			if crc != nil {
+				result.crc32c = crc.Sum32()
+			}
+			timings.add(result.duration)
+			return result
+		}
+
+		// A part stopped by the upload, cancelled or with another part failed, didn't fail itself
+		if ctx.Err() != nil {
+			u.logger().Debug("part upload stopped", "part_number", partNum, "attempt", attempt)
+			return partUploadResult{err: err}
+		}
+		u.logger().Warn("part upload attempt failed", "part_number", partNum, "attempt", attempt, "error", err)
+		// Errors that fail the same way every time are reported right away
+		if attempt > u.Retries || !retryable(err) {
+			return partUploadResult{err: err}
+		}
+		// Stop waiting for the next attempt as soon as the upload is cancelled
+		if err := u.sleep(ctx, retryDelay(err, attempt, u.now())); err != nil {
+			return partUploadResult{err: err}
+		}
+	}
+}
+
+// abort aborts the multipart upload so the uploaded parts stop accruing storage.
+// It targets the bucket and key of the created upload, same as the complete call.
+func (u *Uploader) abort(ctx context.Context, resp *s3.CreateMultipartUploadOutput) error {
+	_, err := u.Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:              resp.Bucket,
+		Key:                 resp.Key,
+		UploadId:            resp.UploadId,
+		RequestPayer:        u.RequestPayer,
+		ExpectedBucketOwner: u.bucketOwner(),
+	})
+	return err
+}
+
+// abortFailed aborts a failed or cancelled multipart upload, unless
+// KeepFailedUploads is set in which case it only logs the ID of the upload
+func (u *Uploader) abortFailed(ctx context.Context, resp *s3.CreateMultipartUploadOutput) error {
+	if u.KeepFailedUploads {
+		u.logger().Warn("multipart upload kept after failure, resume or abort it by its ID", "upload_id", aws.ToString(resp.UploadId),
+			"bucket", aws.ToString(resp.Bucket), "key", aws.ToString(resp.Key))
+		return nil
+	}
+	return u.abort(ctx, resp)
+}
+
+// partSize returns the configured part size, or else one computed from the size
+// of the upload, which is negative when unknown
+func (u *Uploader) partSize(size int64) int64 {
+	if u.PartSize > 0 {
+		return u.PartSize
+	}
+	if size < 0 {
+		return DefaultPartSize
+	}
+	return computePartSize(size)
+}
+
+// checkPartSize rejects a configured part size below MinPartSize for an upload
+// of more than one part of size bytes, negative when unknown. S3 and most
+// compatible stores only accept a smaller part as the last one.
+func (u *Uploader) checkPartSize(size int64) error {
+	if u.PartSize <= 0 || u.PartSize >= MinPartSize {
+		return nil
+	}
+	if size >= 0 && partCount(size, u.PartSize) <= 1 {
+		return nil
+	}
+	return fmt.Errorf("part size %d is below the minimum of %d bytes, only the last part of an upload may be smaller", u.PartSize, MinPartSize)
+}
+
+// computePartSize returns the default part size, or a larger one when a file of
+// fileSize bytes would take more than MaxParts parts of the default size. The
+// result is rounded up to whole MiBs and never below MinPartSize.
+func computePartSize(fileSize int64) int64 {
+	partSize := int64(DefaultPartSize)
+	if fileSize > partSize*MaxParts {
+		partSize = (fileSize + MaxParts - 1) / MaxParts
+		partSize = (partSize + mib - 1) / mib * mib
+	}
+	return max(partSize, MinPartSize)
+}
+
+// multipartThreshold returns the configured multipart threshold or the default one
+func (u *Uploader) multipartThreshold() int64 {
+	switch {
+	case u.MultipartThreshold < 0:
+		return 0
+	case u.MultipartThreshold > 0:
+		return u.MultipartThreshold
+	}
+	return DefaultMultipartThreshold
+}
+
+// logger returns the configured logger or one discarding everything
+func (u *Uploader) logger() *slog.Logger {
+	if u.Logger != nil {
+		return u.Logger
+	}
+	return slog.New(slog.DiscardHandler)
+}
+
+// concurrency returns the configured concurrency or the default one
+func (u *Uploader) concurrency() int {
+	if u.Concurrency > 0 {
+		return u.Concurrency
+	}
+	return DefaultConcurrency
+}
@@ -0,0 +1,637 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// mockS3 is an S3API keeping the uploads in memory and recording the input of
+// every request. Completing or aborting while an UploadPart is still running
+// panics, since S3 may then keep a part that completes afterwards.
+type mockS3 struct {
+	// partFunc, when set, is called by UploadPart once the part was read, with
+	// the attempt of the part starting at 1. An error fails the attempt.
+	partFunc func(ctx context.Context, partNum int32, attempt int) error
+	// putFunc, when set, is called by PutObject once the body was read, with the
+	// attempt starting at 1. An error fails the attempt.
+	putFunc func(attempt int) error
+	// headFunc, when set, changes the output of HeadObject
+	headFunc func(out *s3.HeadObjectOutput)
+
+	mu       sync.Mutex
+	inFlight int
+	attempts map[int32]int
+	parts    map[int32][]byte
+	// Object written by the last PutObject or CompleteMultipartUpload
+	object     []byte
+	objectETag string
+
+	creates     []*s3.CreateMultipartUploadInput
+	uploads     []*s3.UploadPartInput
+	completes   []*s3.CompleteMultipartUploadInput
+	aborts      []*s3.AbortMultipartUploadInput
+	lists       []*s3.ListPartsInput
+	listUploads []*s3.ListMultipartUploadsInput
+	heads       []*s3.HeadObjectInput
+	puts        []*s3.PutObjectInput
+}
+
+func (m *mockS3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.creates = append(m.creates, params)
+	return &s3.CreateMultipartUploadOutput{
+		Bucket:   params.Bucket,
+		Key:      params.Key,
+		UploadId: aws.String(fmt.Sprintf("upload-%d", len(m.creates))),
+	}, nil
+}
+
+func (m *mockS3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	m.mu.Lock()
+	m.uploads = append(m.uploads, params)
+	m.inFlight++
+	if m.attempts == nil {
+		m.attempts = make(map[int32]int)
+	}
+	partNum := aws.ToInt32(params.PartNumber)
+	m.attempts[partNum]++
+	attempt := m.attempts[partNum]
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.inFlight--
+		m.mu.Unlock()
+	}()
+
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	if m.partFunc != nil {
+		if err := m.partFunc(ctx, partNum, attempt); err != nil {
+			return nil, err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.parts == nil {
+		m.parts = make(map[int32][]byte)
+	}
+	m.parts[partNum] = data
+	return &s3.UploadPartOutput{ETag: aws.String(md5ETag(data))}, nil
+}
+
+func (m *mockS3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.inFlight > 0 {
+		panic(fmt.Sprintf("multipart upload completed with %d UploadPart in flight", m.inFlight))
+	}
+	m.completes = append(m.completes, params)
+	var object []byte
+	sums := md5.New()
+	for _, part := range params.MultipartUpload.Parts {
+		data, ok := m.parts[aws.ToInt32(part.PartNumber)]
+		if !ok {
+			return nil, apiError("InvalidPart", http.StatusBadRequest)
+		}
+		sum := md5.Sum(data)
+		sums.Write(sum[:])
+		object = append(object, data...)
+	}
+	m.object = object
+	m.objectETag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sums.Sum(nil)), len(params.MultipartUpload.Parts))
+	return &s3.CompleteMultipartUploadOutput{Bucket: params.Bucket, Key: params.Key, ETag: aws.String(m.objectETag)}, nil
+}
+
+func (m *mockS3) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.inFlight > 0 {
+		panic(fmt.Sprintf("multipart upload aborted with %d UploadPart in flight", m.inFlight))
+	}
+	m.aborts = append(m.aborts, params)
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (m *mockS3) ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lists = append(m.lists, params)
+	out := &s3.ListPartsOutput{Bucket: params.Bucket, Key: params.Key, UploadId: params.UploadId, IsTruncated: aws.Bool(false)}
+	for partNum, data := range m.parts {
+		out.Parts = append(out.Parts, types.Part{PartNumber: aws.Int32(partNum), ETag: aws.String(md5ETag(data)), Size: aws.Int64(int64(len(data)))})
+	}
+	sort.Slice(out.Parts, func(i, j int) bool { return *out.Parts[i].PartNumber < *out.Parts[j].PartNumber })
+	return out, nil
+}
+
+func (m *mockS3) ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listUploads = append(m.listUploads, params)
+	return &s3.ListMultipartUploadsOutput{Bucket: params.Bucket, IsTruncated: aws.Bool(false)}, nil
+}
+
+func (m *mockS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.puts = append(m.puts, params)
+	if m.putFunc != nil {
+		if err := m.putFunc(len(m.puts)); err != nil {
+			return nil, err
+		}
+	}
+	m.object, m.objectETag = data, md5ETag(data)
+	return &s3.PutObjectOutput{ETag: aws.String(m.objectETag)}, nil
+}
+
+func (m *mockS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.heads = append(m.heads, params)
+	if m.objectETag == "" {
+		return nil, &types.NotFound{}
+	}
+	out := &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(m.object))), ETag: aws.String(m.objectETag)}
+	if m.headFunc != nil {
+		m.headFunc(out)
+	}
+	return out, nil
+}
+
+// md5ETag returns the ETag S3 gives to data sent in a single request
+func md5ETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// apiError returns an error like those of the SDK for an S3 response with the
+// error code and HTTP status
+func apiError(code string, status int) error {
+	return &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status, Header: http.Header{}}},
+		Err:      &smithy.GenericAPIError{Code: code, Message: code},
+	}
+}
+
+// testData returns size bytes that differ from one part to the next
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i / 7)
+	}
+	return data
+}
+
+func TestUploadAbortsOnceAfterPartsStopped(t *testing.T) {
+	client := &mockS3{
+		partFunc: func(ctx context.Context, partNum int32, attempt int) error {
+			if partNum == 2 {
+				return apiError("AccessDenied", http.StatusForbidden)
+			}
+			// The other parts run until the failed one cancels them
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize, Concurrency: 4}
+	_, err := u.UploadBytes(context.Background(), "key", testData(4*MinPartSize))
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "AccessDenied" {
+		t.Fatalf("Upload error = %v, want the AccessDenied of part 2", err)
+	}
+	var uploadErr *UploadError
+	if !errors.As(err, &uploadErr) || uploadErr.UploadID != "upload-1" {
+		t.Errorf("Upload error = %v, want an UploadError of upload-1", err)
+	}
+	if len(client.aborts) != 1 {
+		t.Fatalf("%d aborts, want 1", len(client.aborts))
+	}
+	if got := aws.ToString(client.aborts[0].UploadId); got != "upload-1" {
+		t.Errorf("aborted upload %q, want upload-1", got)
+	}
+	if len(client.completes) != 0 {
+		t.Errorf("%d completes of a failed upload, want 0", len(client.completes))
+	}
+}
+
+func TestUploadWithMock(t *testing.T) {
+	tests := []struct {
+		name string
+		// Error of each attempt of part 2, nil when it succeeds
+		part2Err     func(attempt int) error
+		wantErr      string
+		wantAttempts int
+		wantAborts   int
+		wantComplete bool
+	}{
+		{
+			name:         "part failure",
+			part2Err:     func(int) error { return apiError("AccessDenied", http.StatusForbidden) },
+			wantErr:      "AccessDenied",
+			wantAttempts: 1,
+			wantAborts:   1,
+		},
+		{
+			name:         "retries exhausted",
+			part2Err:     func(int) error { return apiError("SlowDown", http.StatusServiceUnavailable) },
+			wantErr:      "SlowDown",
+			wantAttempts: 3,
+			wantAborts:   1,
+		},
+		{
+			name: "successful completion",
+			part2Err: func(attempt int) error {
+				if attempt == 1 {
+					return apiError("SlowDown", http.StatusServiceUnavailable)
+				}
+				return nil
+			},
+			wantAttempts: 2,
+			wantComplete: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3{
+				partFunc: func(ctx context.Context, partNum int32, attempt int) error {
+					if partNum == 2 {
+						return tt.part2Err(attempt)
+					}
+					return nil
+				},
+			}
+			u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize, Retries: 2, clock: newFakeClock()}
+			data := testData(3*MinPartSize + 100)
+			_, err := u.UploadBytes(context.Background(), "key", data)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Upload error = %v, want none", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Upload error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if got := client.attempts[2]; got != tt.wantAttempts {
+				t.Errorf("part 2 sent %d times, want %d", got, tt.wantAttempts)
+			}
+			if len(client.aborts) != tt.wantAborts {
+				t.Errorf("%d aborts, want %d", len(client.aborts), tt.wantAborts)
+			}
+			if completed := len(client.completes) == 1; completed != tt.wantComplete {
+				t.Errorf("%d completes, want completed %v", len(client.completes), tt.wantComplete)
+			}
+			if tt.wantComplete && !bytes.Equal(client.object, data) {
+				t.Errorf("uploaded object of %d bytes differs from the %d bytes of data", len(client.object), len(data))
+			}
+		})
+	}
+}
+
+func TestUploadAbortsOnPartPanic(t *testing.T) {
+	client := &mockS3{
+		partFunc: func(ctx context.Context, partNum int32, attempt int) error {
+			if partNum == 3 {
+				panic("boom")
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize, Concurrency: 4}
+	_, err := u.UploadBytes(context.Background(), "key", testData(4*MinPartSize))
+	if err == nil || !strings.Contains(err.Error(), "part 3: panic: boom") {
+		t.Fatalf("Upload error = %v, want the panic of part 3", err)
+	}
+	if len(client.aborts) != 1 {
+		t.Errorf("%d aborts, want 1", len(client.aborts))
+	}
+}
+
+func TestPartCountAndRange(t *testing.T) {
+	const partSize = 1000
+	tests := []struct {
+		size      int64
+		wantParts int64
+		wantLast  int64
+	}{
+		{3*partSize - 1, 3, partSize - 1},
+		{3 * partSize, 3, partSize},
+		{3*partSize + 1, 4, 1},
+		{1, 1, 1},
+	}
+	for _, tt := range tests {
+		n := partCount(tt.size, partSize)
+		if n != tt.wantParts {
+			t.Errorf("partCount(%d, %d) = %d, want %d", tt.size, partSize, n, tt.wantParts)
+			continue
+		}
+		// The parts follow each other and cover every byte exactly once
+		var next int64
+		for partNum := int64(1); partNum <= n; partNum++ {
+			offset, length := partRange(tt.size, partSize, partNum)
+			if offset != next || length <= 0 {
+				t.Errorf("partRange(%d, %d, %d) = %d, %d, want offset %d and a length above 0", tt.size, partSize, partNum, offset, length, next)
+			}
+			if partNum < n && length != partSize {
+				t.Errorf("partRange(%d, %d, %d) has length %d, want a full part", tt.size, partSize, partNum, length)
+			}
+			if partNum == n && length != tt.wantLast {
+				t.Errorf("last part of %d bytes has length %d, want %d", tt.size, length, tt.wantLast)
+			}
+			next = offset + length
+		}
+		if next != tt.size {
+			t.Errorf("parts of %d bytes end at %d", tt.size, next)
+		}
+	}
+	if n := partCount(0, partSize); n != 0 {
+		t.Errorf("partCount(0, %d) = %d, want 0", partSize, n)
+	}
+}
+
+func TestComputePartSize(t *testing.T) {
+	const limit = DefaultPartSize * MaxParts
+	tests := []struct {
+		fileSize int64
+		want     int64
+	}{
+		{0, DefaultPartSize},
+		{1, DefaultPartSize},
+		{MinPartSize - 1, DefaultPartSize},
+		{limit, DefaultPartSize},
+		// One byte more needs a part of more than 50,000,000 bytes, rounded up to 48 MiB
+		{limit + 1, 48 * mib},
+		{5 * 1024 * 1024 * mib, 525 * mib},
+	}
+	for _, tt := range tests {
+		got := computePartSize(tt.fileSize)
+		if got != tt.want {
+			t.Errorf("computePartSize(%d) = %d, want %d", tt.fileSize, got, tt.want)
+		}
+		if got < MinPartSize || got%mib != 0 && got != DefaultPartSize {
+			t.Errorf("computePartSize(%d) = %d, want whole MiBs of at least MinPartSize", tt.fileSize, got)
+		}
+		if n := partCount(tt.fileSize, got); n > MaxParts {
+			t.Errorf("computePartSize(%d) = %d gives %d parts, more than %d", tt.fileSize, got, n, MaxParts)
+		}
+	}
+}
+
+func TestPartResultWithoutCompletedPartFails(t *testing.T) {
+	if err := (partUploadResult{partNum: 1}).failure(); err == nil || err.Error() != "part upload reported no completed part" {
+		t.Errorf("failure of a result without a part = %v, want the no completed part error", err)
+	}
+	completed := partUploadResult{partNum: 1, completedPart: &types.CompletedPart{PartNumber: aws.Int32(1)}}
+	if err := completed.failure(); err != nil {
+		t.Errorf("failure of a completed part = %v, want nil", err)
+	}
+	partErr := errors.New("part failed")
+	if err := (partUploadResult{partNum: 1, err: partErr}).failure(); err != partErr {
+		t.Errorf("failure of a failed part = %v, want %v", err, partErr)
+	}
+}
+
+func TestAbortTargetsCreatedUpload(t *testing.T) {
+	client := &mockS3{
+		partFunc: func(ctx context.Context, partNum int32, attempt int) error {
+			return apiError("AccessDenied", http.StatusForbidden)
+		},
+	}
+	u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize}
+	if _, err := u.UploadBytes(context.Background(), "dir/report 2026.csv", testData(2*MinPartSize)); err == nil {
+		t.Fatal("Upload succeeded, want the AccessDenied error")
+	}
+	if len(client.creates) != 1 || len(client.aborts) != 1 {
+		t.Fatalf("%d creates and %d aborts, want 1 each", len(client.creates), len(client.aborts))
+	}
+	create, abort := client.creates[0], client.aborts[0]
+	if aws.ToString(abort.Key) != aws.ToString(create.Key) || aws.ToString(abort.Bucket) != aws.ToString(create.Bucket) {
+		t.Errorf("aborted %s/%s, want the created %s/%s", aws.ToString(abort.Bucket), aws.ToString(abort.Key),
+			aws.ToString(create.Bucket), aws.ToString(create.Key))
+	}
+	if got := aws.ToString(abort.UploadId); got != "upload-1" {
+		t.Errorf("aborted upload %q, want upload-1", got)
+	}
+}
+
+func TestCheckPartSize(t *testing.T) {
+	tests := []struct {
+		partSize int64
+		size     int64
+		wantErr  bool
+	}{
+		{mib, 3 * mib, true},
+		{MinPartSize - 1, MinPartSize, true},
+		// Unknown sizes may take more than one part
+		{mib, -1, true},
+		// A single part is the last one, which may be smaller
+		{mib, mib, false},
+		{mib, 100, false},
+		{MinPartSize, 3 * MinPartSize, false},
+		{0, 3 * mib, false},
+	}
+	for _, tt := range tests {
+		u := &Uploader{PartSize: tt.partSize}
+		if err := u.checkPartSize(tt.size); (err != nil) != tt.wantErr {
+			t.Errorf("checkPartSize(%d) with PartSize %d = %v, want error %v", tt.size, tt.partSize, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUploadRejectsSmallPartsBeforeCreating(t *testing.T) {
+	client := &mockS3{}
+	u := &Uploader{Client: client, Bucket: "bucket", PartSize: mib, MultipartThreshold: -1}
+	if _, err := u.UploadBytes(context.Background(), "key", testData(3*mib)); err == nil {
+		t.Fatal("Upload succeeded, want the part size error")
+	}
+	if len(client.creates) != 0 {
+		t.Errorf("%d multipart uploads created, want 0", len(client.creates))
+	}
+}
+
+func TestExpectedBucketOwnerOnEveryRequest(t *testing.T) {
+	const owner = "111122223333"
+	client := &mockS3{}
+	u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize, ExpectedBucketOwner: owner}
+	ctx := context.Background()
+	if _, err := u.UploadBytes(ctx, "multipart", testData(2*MinPartSize)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.UploadBytes(ctx, "small", testData(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.ListParts(ctx, "multipart", "upload-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Abort(ctx, "multipart", "upload-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.AbortStale(ctx, "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(request string, n int, owners func(i int) *string) {
+		t.Helper()
+		if n == 0 {
+			t.Errorf("no %s sent", request)
+		}
+		for i := range n {
+			if got := aws.ToString(owners(i)); got != owner {
+				t.Errorf("%s %d has ExpectedBucketOwner %q, want %q", request, i+1, got, owner)
+			}
+		}
+	}
+	check("CreateMultipartUpload", len(client.creates), func(i int) *string { return client.creates[i].ExpectedBucketOwner })
+	check("UploadPart", len(client.uploads), func(i int) *string { return client.uploads[i].ExpectedBucketOwner })
+	check("CompleteMultipartUpload", len(client.completes), func(i int) *string { return client.completes[i].ExpectedBucketOwner })
+	check("AbortMultipartUpload", len(client.aborts), func(i int) *string { return client.aborts[i].ExpectedBucketOwner })
+	check("ListParts", len(client.lists), func(i int) *string { return client.lists[i].ExpectedBucketOwner })
+	check("ListMultipartUploads", len(client.listUploads), func(i int) *string { return client.listUploads[i].ExpectedBucketOwner })
+	check("HeadObject", len(client.heads), func(i int) *string { return client.heads[i].ExpectedBucketOwner })
+	check("PutObject", len(client.puts), func(i int) *string { return client.puts[i].ExpectedBucketOwner })
+}
+
+func TestUploadBytesThreshold(t *testing.T) {
+	tests := []struct {
+		size          int
+		wantMultipart bool
+	}{
+		{0, false},
+		{DefaultMultipartThreshold - 1, false},
+		{DefaultMultipartThreshold, true},
+		{DefaultMultipartThreshold + 1, true},
+	}
+	for _, tt := range tests {
+		client := &mockS3{}
+		u := &Uploader{Client: client, Bucket: "bucket"}
+		data := testData(tt.size)
+		if _, err := u.UploadBytes(context.Background(), "key", data); err != nil {
+			t.Fatalf("UploadBytes of %d bytes: %v", tt.size, err)
+		}
+		if multipart := len(client.creates) == 1; multipart != tt.wantMultipart || len(client.puts) == 1 == multipart {
+			t.Errorf("UploadBytes of %d bytes: %d multipart uploads and %d PutObjects, want multipart %v",
+				tt.size, len(client.creates), len(client.puts), tt.wantMultipart)
+		}
+		if !bytes.Equal(client.object, data) {
+			t.Errorf("UploadBytes of %d bytes: uploaded %d bytes that differ", tt.size, len(client.object))
+		}
+	}
+}
+
+// lockedBuffer is a buffer for the logs of concurrent parts
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestUploadIDLoggedBeforeParts(t *testing.T) {
+	var logs lockedBuffer
+	var beforeFirstPart []string
+	var once sync.Once
+	client := &mockS3{
+		partFunc: func(ctx context.Context, partNum int32, attempt int) error {
+			once.Do(func() { beforeFirstPart = strings.Split(logs.String(), "\n") })
+			return nil
+		},
+	}
+	u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize, Logger: slog.New(slog.NewTextHandler(&logs, nil))}
+	if _, err := u.UploadBytes(context.Background(), "key", testData(2*MinPartSize)); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range beforeFirstPart {
+		if strings.Contains(line, "multipart upload in progress") && strings.Contains(line, "upload_id=upload-1") {
+			return
+		}
+	}
+	t.Errorf("upload ID not logged before the first part, logs were:\n%s", strings.Join(beforeFirstPart, "\n"))
+}
+
+func TestCancelledUploadIsAborted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var once sync.Once
+	client := &mockS3{
+		partFunc: func(partCtx context.Context, partNum int32, attempt int) error {
+			// Cancel the upload while its parts are in flight
+			once.Do(cancel)
+			<-partCtx.Done()
+			return partCtx.Err()
+		},
+	}
+	u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize, Retries: 3}
+	_, err := u.UploadBytes(ctx, "key", testData(3*MinPartSize))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Upload error = %v, want context.Canceled", err)
+	}
+	if len(client.aborts) != 1 {
+		t.Errorf("%d aborts, want 1", len(client.aborts))
+	}
+	if len(client.completes) != 0 {
+		t.Errorf("%d completes of a cancelled upload, want 0", len(client.completes))
+	}
+}
+
+func TestPutObjectRetries(t *testing.T) {
+	client := &mockS3{
+		putFunc: func(attempt int) error {
+			if attempt < 3 {
+				return apiError("SlowDown", http.StatusServiceUnavailable)
+			}
+			return nil
+		},
+	}
+	clock := newFakeClock()
+	var stats Stats
+	u := &Uploader{Client: client, Bucket: "bucket", Retries: 2, clock: clock, StatsFunc: func(s Stats) { stats = s }}
+	data := testData(1000)
+	if _, err := u.UploadBytes(context.Background(), "key", data); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.puts) != 3 {
+		t.Errorf("%d PutObjects, want 3", len(client.puts))
+	}
+	if waits := clock.recorded(); len(waits) != 2 {
+		t.Errorf("waited %v, want 2 backoffs", waits)
+	}
+	// Each attempt sent the whole object, not what the previous one left unread
+	if !bytes.Equal(client.object, data) {
+		t.Errorf("object of %d bytes differs from the %d bytes of data", len(client.object), len(data))
+	}
+	if len(stats.Parts) != 1 || stats.Parts[0].Attempts != 3 {
+		t.Errorf("stats parts %+v, want one part of 3 attempts", stats.Parts)
+	}
+}
@@ -0,0 +1,183 @@
+package uploader
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// verifyObject fetches the uploaded object with a HEAD request and checks that its
+// size is the local one, catching silent truncation. The ETag is also compared
+// when expectedETag isn't empty.
+func (u *Uploader) verifyObject(ctx context.Context, bucket, key, versionID *string, size int64, expectedETag string) error {
+	head, err := u.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:              bucket,
+		Key:                 key,
+		VersionId:           versionID,
+		RequestPayer:        u.RequestPayer,
+		ExpectedBucketOwner: u.bucketOwner(),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot verify uploaded object: %w", err)
+	}
+	if got := aws.ToInt64(head.ContentLength); got != size {
+		return fmt.Errorf("uploaded object is %d bytes but the local data is %d bytes", got, size)
+	}
+	if got := strings.Trim(aws.ToString(head.ETag), `"`); expectedETag != "" && !strings.EqualFold(got, expectedETag) {
+		return fmt.Errorf("uploaded object has ETag %q but the local parts give %q", got, expectedETag)
+	}
+	return nil
+}
+
+// validateParts checks that the sorted parts are numbered 1 to numParts without
+// gaps or duplicates, which S3 would only reject with a less helpful error on
+// completion, or not at all for missing trailing parts
+func validateParts(parts []types.CompletedPart, numParts int) error {
+	for i, part := range parts {
+		partNum := aws.ToInt32(part.PartNumber)
+		if i > 0 && partNum == aws.ToInt32(parts[i-1].PartNumber) {
+			return fmt.Errorf("part %d was uploaded more than once", partNum)
+		}
+		if want := int32(i + 1); partNum != want {
+			return fmt.Errorf("part %d is missing", want)
+		}
+	}
+	if len(parts) < numParts {
+		return fmt.Errorf("part %d is missing", len(parts)+1)
+	}
+	return nil
+}
+
+// ErrMismatch is wrapped by the errors of Verify for an object that differs from
+// the local data
+var ErrMismatch = errors.New("object doesn't match the local data")
+
+// Verify checks that the object at key holds the size bytes of r without
+// downloading it: its size, its ETag when S3 made it of MD5s, and its additional
+// checksum when it has one. A multipart object is split with the part size an
+// upload of size bytes would use, which must be the one it was uploaded with.
+func (u *Uploader) Verify(ctx context.Context, key string, r io.ReaderAt, size int64) error {
+	head, err := u.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:              aws.String(u.Bucket),
+		Key:                 aws.String(key),
+		ChecksumMode:        types.ChecksumModeEnabled,
+		RequestPayer:        u.RequestPayer,
+		ExpectedBucketOwner: u.bucketOwner(),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot get object: %w", err)
+	}
+	if got := aws.ToInt64(head.ContentLength); got != size {
+		return fmt.Errorf("%w: object is %d bytes but the local data is %d bytes", ErrMismatch, got, size)
+	}
+
+	// A multipart object is checked part by part, any other one as a single part
+	etag := strings.Trim(aws.ToString(head.ETag), `"`)
+	numParts, partSize := int64(1), size
+	if i := strings.LastIndexByte(etag, '-'); i >= 0 {
+		if numParts, err = strconv.ParseInt(etag[i+1:], 10, 64); err != nil {
+			return fmt.Errorf("cannot parse ETag %q of the object", etag)
+		}
+		partSize = u.partSize(size)
+		if want := partCount(size, partSize); want != numParts {
+			return fmt.Errorf("object has %d parts but a part size of %d bytes gives %d, set the part size it was uploaded with", numParts, partSize, want)
+		}
+	}
+
+	// The checksum of a multipart object is either made of the part checksums,
+	// ending in -N, or a CRC of the whole object
+	alg, checksum := objectChecksum(head)
+	var whole hash.Hash32
+	if numParts > 1 && alg != "" && !strings.Contains(checksum, "-") {
+		switch alg {
+		case types.ChecksumAlgorithmCrc32:
+			whole = crc32.NewIEEE()
+		case types.ChecksumAlgorithmCrc32c:
+			whole = crc32.New(castagnoli)
+		}
+	}
+	partAlg := alg
+	if whole != nil {
+		partAlg = ""
+	}
+
+	// Read the file once, part by part
+	etagHash := md5.New()
+	var partMD5, partChecksum string
+	var partChecksums []byte
+	for partNum := int64(1); partNum <= numParts; partNum++ {
+		offset, length := partRange(size, partSize, partNum)
+		sum, sumChecksum, err := partSums(io.NewSectionReader(r, offset, length), partAlg, whole)
+		if err != nil {
+			return err
+		}
+		etagHash.Write(sum)
+		partMD5, partChecksum = hex.EncodeToString(sum), sumChecksum
+		if raw, err := base64.StdEncoding.DecodeString(sumChecksum); err == nil {
+			partChecksums = append(partChecksums, raw...)
+		}
+	}
+
+	// S3 only makes the ETag of MD5s without KMS or customer keys
+	etagChecked := etagIsMD5(head.ServerSideEncryption) && head.SSECustomerAlgorithm == nil
+	if etagChecked {
+		want := partMD5
+		if numParts > 1 || strings.Contains(etag, "-") {
+			want = fmt.Sprintf("%s-%d", hex.EncodeToString(etagHash.Sum(nil)), numParts)
+		}
+		if !strings.EqualFold(etag, want) {
+			return fmt.Errorf("%w: object has ETag %q but the local data gives %q", ErrMismatch, etag, want)
+		}
+	}
+	if alg != "" {
+		want := partChecksum
+		switch {
+		case whole != nil:
+			want = base64.StdEncoding.EncodeToString(whole.Sum(nil))
+		case strings.Contains(checksum, "-"):
+			h, err := newChecksumHash(alg)
+			if err != nil {
+				return err
+			}
+			h.Write(partChecksums)
+			want = fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), numParts)
+		case numParts > 1:
+			// A full object checksum other than a CRC32 or CRC32C
+			u.logger().Warn("checksum of the object not checked", "algorithm", alg)
+			alg, want = "", checksum
+		}
+		if want != checksum {
+			return fmt.Errorf("%w: object has %s checksum %s but the local data gives %s", ErrMismatch, alg, checksum, want)
+		}
+	}
+	u.logger().Info("object matches the local data", "key", key, "size", size, "etag_checked", etagChecked, "checksum", alg)
+	return nil
+}
+
+// objectChecksum returns the additional checksum of an object and its algorithm,
+// or empty strings when it has none
+func objectChecksum(head *s3.HeadObjectOutput) (types.ChecksumAlgorithm, string) {
+	switch {
+	case head.ChecksumCRC32 != nil:
+		return types.ChecksumAlgorithmCrc32, *head.ChecksumCRC32
+	case head.ChecksumCRC32C != nil:
+		return types.ChecksumAlgorithmCrc32c, *head.ChecksumCRC32C
+	case head.ChecksumSHA1 != nil:
+		return types.ChecksumAlgorithmSha1, *head.ChecksumSHA1
+	case head.ChecksumSHA256 != nil:
+		return types.ChecksumAlgorithmSha256, *head.ChecksumSHA256
+	}
+	return "", ""
+}
@@ -0,0 +1,134 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// completedParts returns completed parts with the numbers
+func completedParts(nums ...int32) []types.CompletedPart {
+	parts := make([]types.CompletedPart, len(nums))
+	for i, num := range nums {
+		parts[i] = types.CompletedPart{PartNumber: aws.Int32(num)}
+	}
+	return parts
+}
+
+func TestValidateParts(t *testing.T) {
+	tests := []struct {
+		name     string
+		parts    []types.CompletedPart
+		numParts int
+		wantErr  string
+	}{
+		{"complete", completedParts(1, 2, 3), 3, ""},
+		{"missing first", completedParts(2, 3), 3, "part 1 is missing"},
+		{"missing middle", completedParts(1, 3), 3, "part 2 is missing"},
+		{"missing last", completedParts(1, 2), 3, "part 3 is missing"},
+		{"duplicate", completedParts(1, 2, 2, 3), 3, "part 2 was uploaded more than once"},
+		{"duplicate last", completedParts(1, 2, 3, 3), 3, "part 3 was uploaded more than once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateParts(tt.parts, tt.numParts)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateParts = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validateParts = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// compositeSHA256 returns the SHA256 checksum S3 gives to a multipart object of
+// data split into parts of partSize bytes
+func compositeSHA256(data []byte, partSize int) string {
+	var sums []byte
+	n := 0
+	for offset := 0; offset < len(data); offset += partSize {
+		sum := sha256.Sum256(data[offset:min(offset+partSize, len(data))])
+		sums = append(sums, sum[:]...)
+		n++
+	}
+	sum := sha256.Sum256(sums)
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(sum[:]), n)
+}
+
+func TestVerify(t *testing.T) {
+	data := testData(3*MinPartSize - 10)
+	changed := bytes.Clone(data)
+	changed[MinPartSize+5]++
+	tests := []struct {
+		name     string
+		local    []byte
+		headFunc func(out *s3.HeadObjectOutput)
+		// Expected error, which is ErrMismatch when mismatch is set
+		wantErr  string
+		mismatch bool
+	}{
+		{name: "match", local: data},
+		{name: "size mismatch", local: data[:len(data)-1], wantErr: "object is", mismatch: true},
+		{name: "multipart ETag mismatch", local: changed, wantErr: "object has ETag", mismatch: true},
+		{
+			name:  "wrong part count",
+			local: data,
+			headFunc: func(out *s3.HeadObjectOutput) {
+				out.ETag = aws.String(strings.Replace(aws.ToString(out.ETag), "-3", "-4", 1))
+			},
+			wantErr: "object has 4 parts but a part size of",
+		},
+		{
+			name:  "composite checksum match",
+			local: data,
+			headFunc: func(out *s3.HeadObjectOutput) {
+				out.ChecksumSHA256 = aws.String(compositeSHA256(data, MinPartSize))
+			},
+		},
+		{
+			name:  "composite checksum mismatch",
+			local: data,
+			headFunc: func(out *s3.HeadObjectOutput) {
+				out.ChecksumSHA256 = aws.String(compositeSHA256(changed, MinPartSize))
+			},
+			wantErr:  "SHA256 checksum",
+			mismatch: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockS3{}
+			u := &Uploader{Client: client, Bucket: "bucket", PartSize: MinPartSize}
+			if _, err := u.UploadBytes(context.Background(), "key", data); err != nil {
+				t.Fatal(err)
+			}
+			client.headFunc = tt.headFunc
+			err := u.Verify(context.Background(), "key", bytes.NewReader(tt.local), int64(len(tt.local)))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Verify = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify = %v, want an error containing %q", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrMismatch) != tt.mismatch {
+				t.Errorf("Verify = %v, want ErrMismatch %v", err, tt.mismatch)
+			}
+		})
+	}
+}
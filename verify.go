@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/TahjibNil75/go-s3-uploader/uploader"
+)
+
+// runVerify checks the object at -key against -file for -verify-only and prints
+// whether they match, failing with the difference on a mismatch
+func runVerify(ctx context.Context, w io.Writer, u *uploader.Uploader, opts *options) error {
+	file, err := os.Open(opts.file)
+	if err != nil {
+		return fmt.Errorf("cannot open file: %w", err)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot stat file: %s: %w", opts.file, err)
+	}
+
+	err = u.Verify(ctx, opts.key, file, stat.Size())
+	if errors.Is(err, uploader.ErrMismatch) {
+		fmt.Fprintf(w, "MISMATCH s3://%s/%s\n", opts.bucket, opts.key)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "MATCH s3://%s/%s\n", opts.bucket, opts.key)
+	return nil
+}